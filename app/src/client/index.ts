@@ -1,10 +1,42 @@
 import * as oboe from "oboe";
-import {IContextDetail, IContextList, IResource, IResourceList} from "../model/types";
+import {
+    IContextDetail,
+    IContextList,
+    IPermissionList,
+    IResource,
+    IResourceList,
+    ISettings,
+} from "../model/types";
 
 export type listContextsCallback = (err: Error, result: IContextList) => void;
 export type getContextsCallback = (err: Error, result: IContextDetail) => void;
 export type listResourceCallback = (err: Error, result: IResourceList) => void;
 export type getResourceCallback = (err: Error, result: IResource) => void;
+export type revealValueCallback = (err: Error, result: IRevealedValue) => void;
+export type getUsagesCallback = (err: Error, result: IUsageList) => void;
+export type getPermissionsCallback = (err: Error, result: IPermissionList) => void;
+export type settingsCallback = (err: Error, result: ISettings) => void;
+
+export interface IUsage {
+    resource: string;
+    kind: string;
+    namespace: string;
+    name: string;
+    references: string[];
+}
+
+export interface IUsageList {
+    items: IUsage[];
+    errors?: string[];
+}
+
+export interface IRevealedValue {
+    key: string;
+    value: string;
+}
+
+// apiURL returns the base URL of the context API for the current location.
+export const apiURL = (): string => window.location.protocol + "//" + window.location.host + "/api/contexts";
 
 export class AuthzError extends Error {
     private authzError: boolean;
@@ -15,10 +47,32 @@ export class AuthzError extends Error {
     }
 }
 
+// settingsURL returns the URL of the settings API for the current location.
+export const settingsURL = (): string => window.location.protocol + "//" + window.location.host + "/api/settings";
+
 export class Client {
     constructor(private baseURL: string) {
     }
 
+    public getSettings(cb: settingsCallback) {
+        const url = settingsURL();
+        const stream = oboe({url});
+        stream.on("fail", (err) => this.doError(url, err, cb));
+        stream.on("done", (obj) => cb(null, obj));
+    }
+
+    public putSettings(settings: ISettings, cb: settingsCallback) {
+        const url = settingsURL();
+        const stream = oboe({
+            body: settings,
+            headers: {"Content-Type": "application/json"},
+            method: "PUT",
+            url,
+        });
+        stream.on("fail", (err) => this.doError(url, err, cb));
+        stream.on("done", (obj) => cb(null, obj));
+    }
+
     public listContexts(cb: listContextsCallback) {
         const url = this.baseURL + "/";
         const stream = oboe({url});
@@ -56,13 +110,48 @@ export class Client {
         stream.on("done", (obj) => cb(null, obj));
     }
 
+    public revealValue(context: string, resourceName: string, ns: string, name: string, key: string,
+                       cb: revealValueCallback) {
+        let url = `${this.baseURL}/${context}/reveal/${name}?res=${resourceName}&key=${encodeURIComponent(key)}`;
+        if (ns) {
+            url += "&namespace=" + ns;
+        }
+        const stream = oboe({url});
+        stream.on("fail", (err) => this.doError(url, err, cb));
+        stream.on("done", (obj) => cb(null, obj));
+    }
+
+    public getUsages(context: string, resourceName: string, ns: string, name: string, cb: getUsagesCallback) {
+        const url = `${this.baseURL}/${context}/usages/${name}?res=${resourceName}&namespace=${ns}`;
+        const stream = oboe({url});
+        stream.on("fail", (err) => this.doError(url, err, cb));
+        stream.on("done", (obj) => cb(null, obj));
+    }
+
+    public getPermissions(context: string, ns: string, cb: getPermissionsCallback) {
+        let url = `${this.baseURL}/${context}/permissions`;
+        if (ns) {
+            url += "?namespace=" + ns;
+        }
+        const stream = oboe({url});
+        stream.on("fail", (err) => this.doError(url, err, cb));
+        stream.on("done", (obj) => cb(null, obj));
+    }
+
     private doError(url, err, cb) {
         const {body, statusCode, thrown} = err;
         if (thrown) {
             return cb(new Error(thrown.toString()));
         }
         if (statusCode < 200 || statusCode >= 300) {
-            const msg = `unexpected error accessing ${url}\nstatus code: ${statusCode}, body: ${body}`;
+            let msg = `unexpected error accessing ${url}\nstatus code: ${statusCode}, body: ${body}`;
+            const status = this.parseStatus(body);
+            if (status) {
+                msg = `${status.reason || "Error"} (${status.code || statusCode}): ${status.message}`;
+                if (status.details) {
+                    msg += `\ndetails: ${JSON.stringify(status.details)}`;
+                }
+            }
             if (statusCode === 403) {
                 return cb(new AuthzError(msg));
             }
@@ -74,6 +163,21 @@ export class Client {
         return cb(new Error(`unexpected error accessing ${url}`));
     }
 
+    private parseStatus(body): any {
+        let status = body;
+        if (typeof body === "string") {
+            try {
+                status = JSON.parse(body);
+            } catch (e) {
+                return null;
+            }
+        }
+        if (status && status.kind === "Status") {
+            return status;
+        }
+        return null;
+    }
+
     private addParams(url: string, params: object): string {
         if (params) {
             Object.keys(params).forEach( (p) => {
@@ -0,0 +1,64 @@
+import * as React from "react";
+import {Loader, Message, Table} from "semantic-ui-react";
+import {apiURL, Client, IUsageList} from "../../../../client";
+import {ResourceQuery} from "../../../../model/types";
+import {versionlessResourceType} from "../../../../util";
+import {ObjectLink} from "./object-link";
+
+interface IUsedByProps {
+    query: ResourceQuery;
+}
+
+interface IUsedByState {
+    loading: boolean;
+    err?: Error;
+    usages?: IUsageList;
+}
+
+// UsedByUI shows the pods and workloads that reference a config map, secret or service account.
+export class UsedByUI extends React.Component<IUsedByProps, IUsedByState> {
+    constructor(props, state) {
+        super(props, state);
+        this.state = {loading: true};
+    }
+
+    public componentDidMount() {
+        const q = this.props.query;
+        const client = new Client(apiURL());
+        client.getUsages(q.k8sContext, q.resourceType, q.namespace, q.objectId, (err, usages) => {
+            this.setState({loading: false, err, usages});
+        });
+    }
+
+    public render() {
+        if (this.state.loading) {
+            return <Loader active inline="centered"/>;
+        }
+        if (this.state.err) {
+            return (
+                <Message error>
+                    <Message.Header>Unable to load usages</Message.Header>
+                    <pre className="wrapped">{this.state.err.message}</pre>
+                </Message>
+            );
+        }
+        const items = (this.state.usages && this.state.usages.items) || [];
+        const rows = items.map((u) => (
+            <Table.Row key={u.kind + "/" + u.name}>
+                <Table.Cell>{u.kind}</Table.Cell>
+                <Table.Cell>
+                    <ObjectLink type={versionlessResourceType(u.resource)} namespace={u.namespace} name={u.name}>
+                        {u.name}
+                    </ObjectLink>
+                </Table.Cell>
+                <Table.Cell>{u.references.join(", ")}</Table.Cell>
+            </Table.Row>
+        ));
+        return (
+            <React.Fragment>
+                <h3>Used by</h3>
+                {rows.length ? <Table basic="very" celled collapsing>{rows}</Table> : <div>Not used by any pods or workloads</div>}
+            </React.Fragment>
+        );
+    }
+}
@@ -1,5 +1,6 @@
 import * as React from "react";
 import {Segment} from "semantic-ui-react";
+import {UsedByUI} from "./common/used-by";
 import {DetailUI} from "./detail-ui";
 
 export class ConfigMapDetailUI extends DetailUI {
@@ -24,6 +25,7 @@ export class ConfigMapDetailUI extends DetailUI {
             <React.Fragment>
                 <h3>Configuration data</h3>
                 {items.length ? items : <div>No data found</div>}
+                <UsedByUI query={this.props.qr.query}/>
             </React.Fragment>
         );
     }
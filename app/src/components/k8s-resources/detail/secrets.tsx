@@ -1,31 +1,55 @@
 import * as React from "react";
-import {Checkbox, Segment} from "semantic-ui-react";
+import {Button, Segment} from "semantic-ui-react";
+import {apiURL, Client} from "../../../client";
+import {UsedByUI} from "./common/used-by";
 import {DetailUI} from "./detail-ui";
 
-const  render = (item, component): React.ReactNode => {
-    const secretState = component.state || {showSecrets: false};
+const redactedValue = "<redacted>";
+
+const render = (item, component): React.ReactNode => {
+    const secretState = component.state || {revealed: {}};
+    const revealed = secretState.revealed || {};
     const t = (item as any).type;
     const data = (item as any).data as object || {};
     const keys = Object.keys(data).sort();
+    const q = component.props.qr.query;
+    const reveal = (key) => {
+        const client = new Client(apiURL());
+        client.revealValue(q.k8sContext, q.resourceType, q.namespace, q.objectId, key, (err, result) => {
+            const value = err ? `error: ${err.message}` : result.value;
+            component.setState({revealed: {...revealed, [key]: value}});
+        });
+    };
+    const hide = (key) => {
+        const next = {...revealed};
+        delete next[key];
+        component.setState({revealed: next});
+    };
     const items = keys.map((key) => {
-        return !secretState.showSecrets ? <h4>{key}</h4> : (
+        const isRevealed = key in revealed;
+        let value: React.ReactNode = null;
+        if (isRevealed) {
+            value = <pre className="wrapped">{revealed[key]}</pre>;
+        } else if (data[key] !== redactedValue) {
+            value = <pre className="wrapped">{Buffer.from(data[key], "base64").toString()}</pre>;
+        }
+        return (
             <Segment raised key={key}>
-                <h4>{key}</h4>
-                <pre className="wrapped">{Buffer.from(data[key], "base64").toString()}</pre>
+                <h4>
+                    {key}&nbsp;&nbsp;
+                    <Button size="mini" onClick={() => isRevealed ? hide(key) : reveal(key)}>
+                        {isRevealed ? "Hide" : "Reveal"}
+                    </Button>
+                </h4>
+                {value}
             </Segment>
         );
     });
-    const toggleReveal = (e, d) => {
-        component.setState({showSecrets: d.checked});
-    };
-    const reveal = (items.length > 0 && (
-        <Checkbox toggle onChange={toggleReveal} label="Reveal secret values"/>
-    ));
     return (
         <React.Fragment>
             <h3>Secrets <small>({t})</small></h3>
-            {reveal}
             {items.length ? items : <div>No data found</div>}
+            <UsedByUI query={q}/>
         </React.Fragment>
     );
 };
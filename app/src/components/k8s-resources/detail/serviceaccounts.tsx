@@ -2,6 +2,7 @@ import * as React from "react";
 import {List, Table} from "semantic-ui-react";
 import {DetailUI} from "./detail-ui";
 import {ObjectLink} from "./common/object-link";
+import {UsedByUI} from "./common/used-by";
 import {StandardResourceTypes} from "../../../util";
 
 const secretLink = (secret, currentNs) => {
@@ -56,6 +57,7 @@ const render = (item, component): React.ReactNode => {
         <React.Fragment>
             <h2>Attributes</h2>
             <Table basic="very" celled collapsing>{rows}</Table>
+            <UsedByUI query={component.props.qr.query}/>
         </React.Fragment>
     );
 };
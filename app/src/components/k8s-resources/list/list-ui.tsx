@@ -106,10 +106,17 @@ export class ListUI extends React.Component<IList, {}> {
                 return null;
             }
         }
+        const partial = !err && results && results.error && (
+            <Message warning>
+                <Message.Header>Partial results</Message.Header>
+                <pre className="wrapped">{results.error.message}</pre>
+            </Message>
+        );
         return (
             <Segment raised>
                 {header}
                 {err}
+                {partial}
                 {content}
             </Segment>
         );
@@ -1,5 +1,11 @@
 import {ListUI} from "./list-ui";
 
+// allocation returns the allocated amount of a resource against the allocatable amount.
+const allocation = (n, allocated: string, allocatable: string) => {
+    const d = n.derived;
+    return d.allocated ? `${d.allocated[allocated]} / ${d.allocatable[allocatable]}` : "";
+};
+
 const cols = [
     {
         Header: "Status",
@@ -21,6 +27,16 @@ const cols = [
         accessor: "derived.podCIDR",
         id: "podCIDR",
     },
+    {
+        Header: "CPU Requests",
+        accessor: (n) => allocation(n, "cpuRequests", "cpu"),
+        id: "cpuRequests",
+    },
+    {
+        Header: "Memory Requests",
+        accessor: (n) => allocation(n, "memoryRequests", "memory"),
+        id: "memoryRequests",
+    },
     {
         Header: "External ID",
         accessor: "derived.externalID",
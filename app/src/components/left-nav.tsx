@@ -9,6 +9,7 @@ type countFn = (name: string) => any;
 type loadingFn = (name: string) => boolean;
 type errorFn = (name: string) => any;
 type selectFn = (name: string) => boolean;
+type forbiddenFn = (name: string) => boolean;
 type clickFn = (evt: any, props: ILinkItemProps) => any;
 
 interface IResultFinder {
@@ -16,6 +17,7 @@ interface IResultFinder {
     loadingFn: loadingFn;
     errorFn: errorFn;
     selectFn: selectFn;
+    forbiddenFn: forbiddenFn;
 }
 
 interface ILinkItemProps {
@@ -25,6 +27,7 @@ interface ILinkItemProps {
     loading?: boolean;
     err?: IExtendedError;
     selected?: boolean;
+    forbidden?: boolean;
     onClick: clickFn;
     allResourceTypes: string[];
 }
@@ -46,6 +49,14 @@ class LinkItem extends React.Component<ILinkItemProps, {}> {
             return null;
         }
 
+        if (!this.props.selected && this.props.forbidden) {
+            return (
+                <div className="list-link" title="you are not allowed to list these objects">
+                    <span style={{color: "grey"}}>{title}&nbsp;<Icon name="lock" className="grey"/></span>
+                </div>
+            );
+        }
+
         return (
             <div className={this.props.selected ? "list-link list-link-selected" : "list-link"}>
                 <a href="#" onClick={this.onClick}>
@@ -86,6 +97,7 @@ class GroupItem extends React.Component<IGroupProps, {}> {
                 allResourceTypes: this.props.allResourceTypes,
                 count: this.props.finder.countFn(res.id),
                 err: this.props.finder.errorFn(res.id),
+                forbidden: this.props.finder.forbiddenFn(res.id),
                 loading: this.props.finder.loadingFn(res.id),
                 name: res.id,
                 onClick: this.props.onClick,
@@ -197,6 +209,20 @@ export const LeftNav = connect(
                 const qr = getData(name);
                 return qr && qr.err;
             },
+            forbiddenFn: (name: string) => {
+                const pc = s.permissionsCache;
+                if (name === "" || !(pc && pc.permissions && pc.contextName === s.selection.context)) {
+                    return false;
+                }
+                // incomplete rules do not say what is forbidden, except for cluster
+                // resources which are reviewed individually
+                const info = StateReader.getResourceInfo(s, name);
+                if (pc.permissions.incomplete && !(info && info.isClusterResource)) {
+                    return false;
+                }
+                const verbs = pc.permissions.resources[name];
+                return !!verbs && verbs.indexOf("list") < 0;
+            },
             loadingFn: (name: string) => {
                 if (name === "") {
                     return false;
@@ -1,5 +1,7 @@
 import * as React from "react";
 import {connect} from "react-redux";
+import {Form, Input} from "semantic-ui-react";
+import {ActionFactory} from "../model/actions";
 import {State, StateReader} from "../model/state";
 import {QueryScope} from "../model/types";
 import {renderList} from "./k8s-resources/list";
@@ -9,11 +11,34 @@ export interface IListPageProps {
     state: State;
 }
 
-interface IListPage extends IListPageProps {
+interface IListPageEvents {
+    onFilter(filter: string);
+}
+
+interface IListPage extends IListPageProps, IListPageEvents {
+
+}
 
+interface IListPageState {
+    filter: string;
 }
 
-export class ListPageUI extends React.Component<IListPage, {}> {
+export class ListPageUI extends React.Component<IListPage, IListPageState> {
+    constructor(props, state) {
+        super(props, state);
+        this.state = {filter: this.currentFilter()};
+        this.onChange = this.onChange.bind(this);
+        this.onSubmit = this.onSubmit.bind(this);
+    }
+
+    public componentDidUpdate(prevProps: IListPage) {
+        const prev = StateReader.getListPageSelection(prevProps.state);
+        const filter = this.currentFilter();
+        if ((prev && prev.filter || "") !== filter) {
+            this.setState({filter});
+        }
+    }
+
     public render() {
         const state = this.props.state;
         const sel = StateReader.getListPageSelection(state);
@@ -37,15 +62,42 @@ export class ListPageUI extends React.Component<IListPage, {}> {
         });
         return (
             <React.Fragment>
+                <Form onSubmit={this.onSubmit}>
+                    <Input
+                        fluid
+                        icon="filter"
+                        iconPosition="left"
+                        placeholder="filter, e.g. nginx, labels.app:web or nodeName:/^ip-10-/"
+                        value={this.state.filter}
+                        onChange={this.onChange}
+                    />
+                </Form>
                 {pages}
             </React.Fragment>
         );
     }
+
+    private currentFilter(): string {
+        const sel = StateReader.getListPageSelection(this.props.state);
+        return (sel && sel.filter) || "";
+    }
+
+    private onChange(event, {value}) {
+        this.setState({filter: value});
+    }
+
+    private onSubmit() {
+        this.props.onFilter(this.state.filter.trim());
+    }
 }
 
 export const ListPage = connect(
-    (s: State): IListPage => ({ state: s }),
-    (dispatch) => {
-        return {};
+    (s: State): IListPageProps => ({ state: s }),
+    (dispatch): IListPageEvents => {
+        return {
+            onFilter: (filter) => {
+                dispatch(ActionFactory.filterListPage(filter));
+            },
+        };
     },
 )(ListPageUI);
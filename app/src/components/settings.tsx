@@ -0,0 +1,198 @@
+import * as React from "react";
+import {connect} from "react-redux";
+import {Button, Form, Message, Modal} from "semantic-ui-react";
+import {ActionFactory} from "../model/actions";
+import {State} from "../model/state";
+import {ISettings, SettingsUpdate} from "../model/types";
+
+interface ISettingsProps {
+    settings: ISettings;
+    loadErr: Error;
+    update: SettingsUpdate;
+    contexts: string[];
+    context: string;
+    kinds: string[];
+}
+
+interface ISettingsEvents {
+    onSave(settings: ISettings);
+}
+
+interface ISettingsEditor extends ISettingsProps, ISettingsEvents {
+}
+
+interface ISettingsState {
+    open: boolean;
+    favoriteContexts: string[];
+    hiddenKinds: string[];
+    useDefaultImpersonation: boolean;
+    user: string;
+}
+
+const options = (values: string[]) => values.map((v) => ({key: v, text: v, value: v}));
+
+class SettingsUI extends React.Component<ISettingsEditor, ISettingsState> {
+    constructor(props, state) {
+        super(props, state);
+        this.state = this.initialState();
+        this.onOpen = this.onOpen.bind(this);
+        this.onClose = this.onClose.bind(this);
+        this.onSave = this.onSave.bind(this);
+        this.onFavoritesChange = this.onFavoritesChange.bind(this);
+        this.onHiddenKindsChange = this.onHiddenKindsChange.bind(this);
+        this.onDefaultImpersonationChange = this.onDefaultImpersonationChange.bind(this);
+        this.onUserChange = this.onUserChange.bind(this);
+    }
+
+    public componentDidUpdate(prevProps: ISettingsEditor) {
+        const prev = prevProps.update || {};
+        const update = this.props.update || {};
+        if (this.state.open && prev.saving && !update.saving && !update.err) {
+            this.setState({open: false});
+        }
+    }
+
+    public render() {
+        const update = this.props.update || {};
+        const loadErr = this.props.loadErr;
+        const kinds = this.props.kinds.concat(this.state.hiddenKinds.filter((k) => this.props.kinds.indexOf(k) < 0));
+        const trigger = <Button basic icon="setting" floated="right" title="settings" onClick={this.onOpen}/>;
+        return (
+            <Modal trigger={trigger} open={this.state.open} onClose={this.onClose}>
+                <Modal.Header>Settings</Modal.Header>
+                <Modal.Content>
+                    <Form error={!!update.err} onSubmit={this.onSave}>
+                        <Form.Dropdown
+                            label="Favorite contexts, listed first"
+                            options={options(this.props.contexts)}
+                            value={this.state.favoriteContexts}
+                            onChange={this.onFavoritesChange}
+                            multiple search selection
+                        />
+                        <Form.Dropdown
+                            label="Kinds hidden from the navigation"
+                            options={options(kinds)}
+                            value={this.state.hiddenKinds}
+                            onChange={this.onHiddenKindsChange}
+                            allowAdditions multiple search selection
+                        />
+                        {this.props.context && this.renderImpersonation()}
+                        <Message error content={update.err && update.err.message}/>
+                        {loadErr && <Message warning visible header="Unable to load the settings"
+                                             content={loadErr.message}/>}
+                    </Form>
+                </Modal.Content>
+                <Modal.Actions>
+                    <Button content="Cancel" onClick={this.onClose}/>
+                    <Button primary content="Save" loading={!!update.saving} disabled={!!loadErr}
+                            onClick={this.onSave}/>
+                </Modal.Actions>
+            </Modal>
+        );
+    }
+
+    private renderImpersonation() {
+        return (
+            <React.Fragment>
+                <Form.Checkbox
+                    label={`Use the default impersonation for ${this.props.context}`}
+                    checked={this.state.useDefaultImpersonation}
+                    onChange={this.onDefaultImpersonationChange}
+                />
+                <Form.Input
+                    label={`User to impersonate in ${this.props.context}, empty for none`}
+                    disabled={this.state.useDefaultImpersonation}
+                    value={this.state.user}
+                    onChange={this.onUserChange}
+                />
+                <Message info size="small" content="Impersonation changes take effect the next time kui is started."/>
+            </React.Fragment>
+        );
+    }
+
+    private initialState(): ISettingsState {
+        const s = this.props.settings || {};
+        const imp = (s.contextImpersonation || {})[this.props.context];
+        return {
+            favoriteContexts: s.favoriteContexts || [],
+            hiddenKinds: s.hiddenKinds || [],
+            open: false,
+            useDefaultImpersonation: !imp,
+            user: (imp && imp.user) || "",
+        };
+    }
+
+    private onOpen() {
+        this.setState({...this.initialState(), open: true});
+    }
+
+    private onClose() {
+        this.setState({open: false});
+    }
+
+    private onFavoritesChange(event, {value}) {
+        this.setState({favoriteContexts: value});
+    }
+
+    private onHiddenKindsChange(event, {value}) {
+        this.setState({hiddenKinds: value});
+    }
+
+    private onDefaultImpersonationChange(event, {checked}) {
+        this.setState({useDefaultImpersonation: checked});
+    }
+
+    private onUserChange(event, {value}) {
+        this.setState({user: value});
+    }
+
+    private onSave() {
+        const s = this.props.settings || {};
+        const contextImpersonation = {...(s.contextImpersonation || {})};
+        const ctx = this.props.context;
+        if (ctx) {
+            const imp = contextImpersonation[ctx];
+            if (this.state.useDefaultImpersonation) {
+                delete contextImpersonation[ctx];
+            } else if (!imp || imp.user !== this.state.user) {
+                // an empty entry turns off the default impersonation for the context
+                contextImpersonation[ctx] = {user: this.state.user};
+            }
+        }
+        this.props.onSave({
+            ...s,
+            contextImpersonation,
+            favoriteContexts: this.state.favoriteContexts,
+            hiddenKinds: this.state.hiddenKinds,
+        });
+    }
+}
+
+export const Settings = connect(
+    (s: State): ISettingsProps => {
+        const kinds = [];
+        const detail = s.contextCache && s.contextCache.detail;
+        ((detail && detail.resources) || []).forEach((res) => {
+            const kind = res.id.substring(res.id.indexOf(":") + 1);
+            if (kinds.indexOf(kind) < 0) {
+                kinds.push(kind);
+            }
+        });
+        kinds.sort();
+        return {
+            context: s.selection.context || "",
+            contexts: s.availableContexts,
+            kinds,
+            loadErr: s.settingsErr,
+            settings: s.settings,
+            update: s.settingsUpdate,
+        };
+    },
+    (dispatch): ISettingsEvents => {
+        return {
+            onSave: (settings) => {
+                dispatch(ActionFactory.saveSettings(settings));
+            },
+        };
+    },
+)(SettingsUI);
@@ -4,6 +4,7 @@ import {Label, Segment} from "semantic-ui-react";
 import {State} from "../model/state";
 import {ContextList} from "./context-list";
 import {NamespaceList} from "./namespace-list";
+import {Settings} from "./settings";
 
 interface ITopBarProps {
     location: object;
@@ -16,6 +17,7 @@ class TopBarUI extends React.Component<ITopBarProps, {}> {
                 <Label pointing="right" content="Context"/>
                 <ContextList/>
                 <NamespaceList/>
+                <Settings/>
             </Segment>
         );
     }
@@ -6,6 +6,8 @@ import {
     NamespaceListCache,
     NamespaceSelection,
     ObjectSelection,
+    PermissionsCache,
+    ISettings,
     ResourceQueryResults,
 } from "./types";
 
@@ -13,16 +15,20 @@ export enum ActionTypes {
     UI_SELECT_CONTEXT = "select context",
     UI_SELECT_NAMESPACE = "select namespace",
     UI_SELECT_LIST_PAGE = "select list page",
+    UI_FILTER_LIST_PAGE = "filter list page",
     UI_SELECT_OBJECT = "select object",
+    UI_SAVE_SETTINGS = "save settings",
 
     // data events, namespaces are treated specially since
     // they drive processing.
     START_CONTEXT_LOAD = "start context load",
     GET_CONTEXT_DETAIL = "get context detail",
     GET_NAMESPACE_LIST = "get namespace list",
+    GET_PERMISSIONS = "get permissions",
     START_QUERIES = "start data load",
     DATA_RESULT = "load results",
     CLEAR_CACHE= "clear cache",
+    SETTINGS_SAVED = "settings saved",
 
     // from react router redux, cannot use exported value in enum
     LOCATION_CHANGED = "@@router/LOCATION_CHANGE",
@@ -49,11 +55,23 @@ export interface ISelectListPage extends Action {
     resourceTypes: string[];
 }
 
+// sent when the user changes the filter of the current list page.
+export interface IFilterListPage extends Action {
+    type: ActionTypes.UI_FILTER_LIST_PAGE;
+    filter: string;
+}
+
 export interface ISelectObject extends Action {
     type: ActionTypes.UI_SELECT_OBJECT;
     selection: ObjectSelection;
 }
 
+// sent when the user saves the settings.
+export interface ISaveSettings extends Action {
+    type: ActionTypes.UI_SAVE_SETTINGS;
+    settings: ISettings;
+}
+
 export interface IStartContextLoad extends Action {
     type: ActionTypes.START_CONTEXT_LOAD;
     cc: ContextCache;
@@ -71,6 +89,12 @@ export interface IListNamespaces extends Action {
     nl: NamespaceListCache;
 }
 
+// sent when starting and finishing a permissions load.
+export interface IGetPermissions extends Action {
+    type: ActionTypes.GET_PERMISSIONS;
+    pc: PermissionsCache;
+}
+
 // sent when loading other data.
 export interface IStartQueries extends Action {
     type: ActionTypes.START_QUERIES;
@@ -84,6 +108,13 @@ export interface IDataResult extends Action {
     qr: ResourceQueryResults;
 }
 
+// sent when the settings have been saved, or failed to save.
+export interface ISettingsSaved extends Action {
+    type: ActionTypes.SETTINGS_SAVED;
+    settings?: ISettings;
+    err?: Error;
+}
+
 export interface IClearCache extends Action {
     type: ActionTypes.CLEAR_CACHE;
 }
@@ -103,13 +134,17 @@ export type AppAction =
     | ISelectContext
     | ISelectNamespace
     | ISelectListPage
+    | IFilterListPage
     | ISelectObject
+    | ISaveSettings
     | IStartContextLoad
     | IGetContextDetail
     | IListNamespaces
+    | IGetPermissions
     | IStartQueries
     | IDataResult
     | IClearCache
+    | ISettingsSaved
     | ILocationChange
     | IOtherMessage;
 
@@ -127,10 +162,18 @@ export class ActionFactory {
         return {resourceTypes, title, type: ActionTypes.UI_SELECT_LIST_PAGE};
     }
 
+    public static filterListPage(filter: string): IFilterListPage {
+        return {filter, type: ActionTypes.UI_FILTER_LIST_PAGE};
+    }
+
     public static selectObject(resourceType: string, namespace: string, name: string): ISelectObject {
         return {selection: {name, namespace, resourceType}, type: ActionTypes.UI_SELECT_OBJECT};
     }
 
+    public static saveSettings(settings: ISettings): ISaveSettings {
+        return {settings, type: ActionTypes.UI_SAVE_SETTINGS};
+    }
+
     public static startContextLoad(cc: ContextCache, nl: NamespaceListCache): IStartContextLoad {
         return {cc, nl, type: ActionTypes.START_CONTEXT_LOAD};
     }
@@ -143,6 +186,10 @@ export class ActionFactory {
         return {nl, type: ActionTypes.GET_NAMESPACE_LIST};
     }
 
+    public static getPermissions(pc: PermissionsCache): IGetPermissions {
+        return {pc, type: ActionTypes.GET_PERMISSIONS};
+    }
+
     public static startQueries(queries: IQueryWithLocation[]): IStartQueries {
         return {queries, type: ActionTypes.START_QUERIES};
     }
@@ -154,4 +201,8 @@ export class ActionFactory {
     public static clearCache(): IClearCache {
         return { type: ActionTypes.CLEAR_CACHE};
     }
+
+    public static settingsSaved(settings: ISettings, err: Error): ISettingsSaved {
+        return {err, settings, type: ActionTypes.SETTINGS_SAVED};
+    }
 }
@@ -5,6 +5,7 @@ import {setDoctitle} from "./set-doc-title";
 import {stateWatch} from "./state-watch";
 import {loadRelatedData} from "./related-data";
 import {setScrollPosition} from "./scroller";
+import {saveSettings} from "./settings";
 
 export function getMiddleware(client: Client): Middleware[] {
     return [
@@ -13,5 +14,6 @@ export function getMiddleware(client: Client): Middleware[] {
         loadRelatedData(client),
         setDoctitle(client),
         setScrollPosition(client),
+        saveSettings(client),
     ];
 }
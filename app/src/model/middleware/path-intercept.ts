@@ -3,7 +3,7 @@ import {push} from "react-router-redux";
 import {Client} from "../../client";
 import {ActionFactory, ActionTypes} from "../actions";
 import {selection2Path} from "../pathmap";
-import {State} from "../state";
+import {State, StateReader} from "../state";
 import {QueryScope, Selection} from "../types";
 
 const navigateTo = (dispatch: any, sel: Selection) => {
@@ -39,6 +39,15 @@ export const pathIntercept = (client: Client) => ({dispatch, getState}) => (next
                 namespace: state.selection.namespace,
             });
 
+        case ActionTypes.UI_FILTER_LIST_PAGE: {
+            const ls = StateReader.getListPageSelection(state);
+            return navigateTo(dispatch, {
+                context: state.selection.context,
+                list: ls && {...ls, filter: action.filter},
+                namespace: state.selection.namespace,
+            });
+        }
+
         case ActionTypes.UI_SELECT_OBJECT:
         return navigateTo(dispatch, {
                 context: state.selection.context,
@@ -0,0 +1,14 @@
+import {Client} from "../../client";
+import {ActionFactory, ActionTypes, ISaveSettings} from "../actions";
+
+// saveSettings writes the settings edited in the UI to the server.
+export const saveSettings = (client: Client) => ({dispatch}) => (next) => (action) => {
+    next(action);
+    if (action.type !== ActionTypes.UI_SAVE_SETTINGS) {
+        return null;
+    }
+    client.putSettings((action as ISaveSettings).settings, (err, settings) => {
+        dispatch(ActionFactory.settingsSaved(settings, err));
+    });
+    return null;
+};
@@ -3,20 +3,11 @@ import {Client} from "../../client";
 import {ActionFactory, ActionTypes} from "../actions";
 import {State, StateReader} from "../state";
 import {IQueryWithLocation, IResultsPath, ResourceQuery} from "../types";
+import {versionlessResourceType} from "../../util";
 
 export const loadList = (dispatch: any, client: Client, queryLoc: IQueryWithLocation) => {
     const q = queryLoc.query;
     client.listResources(q.k8sContext, q.resourceType, q.namespace, queryLoc.query.params, (err, results) => {
-        if (results && results.items && results.items.length > 0) {
-            results.items.sort( (a, b) => {
-                const at = a.metadata && a.metadata.creationTimestamp;
-                const bt = b.metadata && b.metadata.creationTimestamp;
-                if (at < bt) {
-                    return 1;
-                }
-                return -1;
-            });
-        }
         dispatch(ActionFactory.dataResult({
             err,
             query: q,
@@ -88,6 +79,23 @@ export const stateWatch = (client: Client) => ({dispatch, getState}) => (next) =
         return;
     }
 
+    // permissions are loaded in the background and only affect the display
+    const permNS = (sel.namespace && sel.namespace.namespace) || "";
+    const pc = state.permissionsCache;
+    if (StateReader.isNamespaceSelected(state) &&
+        !(pc && pc.contextName === sel.context && pc.namespace === permNS)) {
+        dispatch(ActionFactory.getPermissions({contextName: sel.context, loading: true, namespace: permNS}));
+        client.getPermissions(sel.context, permNS, (err, permissions) => {
+            dispatch(ActionFactory.getPermissions({
+                contextName: sel.context,
+                err,
+                namespace: permNS,
+                permissions,
+            }));
+        });
+        return;
+    }
+
     if ((state.contextCache && state.contextCache.loading) || (state.namespaceCache && state.namespaceCache.loading)) {
         return;
     }
@@ -99,9 +107,19 @@ export const stateWatch = (client: Client) => ({dispatch, getState}) => (next) =
         ls.resourceTypes.forEach((resourceType) => {
             const location: IResultsPath = { path: StateReader.listQueryKey(state, resourceType), queryName: ""};
             if (!StateReader.hasResults(state, location)) {
+                // lists are filtered and sorted newest first by the server
+                const params: any = {sort: "-metadata.creationTimestamp"};
+                if (ls.filter) {
+                    params.filter = ls.filter;
+                }
+                // nodes show the resources allocated to their pods
+                if (versionlessResourceType(resourceType) === "/:Node") {
+                    params.allocated = "true";
+                }
                 const query: ResourceQuery = {
                     k8sContext: state.selection.context,
                     namespace: state.selection.namespace.namespace,
+                    params,
                     resourceType,
                 };
                 queries.push({
@@ -28,6 +28,10 @@ describe("path2Selection", () => {
         const s = path2Selection({pathname: "/ui/foobar/ns,baz"});
         a.deepEqual(s, {context: "foobar", namespace: {scope: QueryScope.SINGLE_NAMESPACE, namespace: "baz"}});
     });
+    it("returns list with filter", () => {
+        const s = path2Selection({pathname: "/ui/foobar/all", search: "?lr=v1%3APod&lt=Pods&lf=app%3Aweb"});
+        a.deepEqual(s.list, {filter: "app:web", resourceTypes: ["v1:Pod"], title: "Pods"});
+    });
 });
 
 describe("selection2Path", () => {
@@ -55,4 +59,8 @@ describe("selection2Path", () => {
         const s = selection2Path({context: "foo", namespace: {scope: QueryScope.SINGLE_NAMESPACE, namespace: ""}});
         a.deepEqual(s, {pathname: "/ui/foo", search: ""});
     });
+    it("returns list filter in search", () => {
+        const s = selection2Path({context: "foo", list: {filter: "app:web", resourceTypes: ["v1:Pod"], title: "Pods"}});
+        a.deepEqual(s, {pathname: "/ui/foo", search: "lr=v1%3APod&lt=Pods&lf=app%3Aweb"});
+    });
 });
@@ -7,6 +7,7 @@ const ROOT_PATH = "/";
 const UI_PATH = "/ui";
 const LIST_TITLE_PARAM = "lt";
 const LIST_RESOURCE_PARAM = "lr";
+const LIST_FILTER_PARAM = "lf";
 const OBJECT_RESOURCE_PARAM = "or";
 const OBJECT_NAMESPACE_PARAM = "ons";
 const OBJECT_NAME_PARAM = "on";
@@ -67,6 +68,10 @@ export const path2Selection = (loc: LocationDescriptorObject): Selection => {
                 resourceTypes: Array.isArray(lr) ? lr : [lr],
                 title: query[LIST_TITLE_PARAM].toString() || "",
             };
+            const lf = singularParam(query[LIST_FILTER_PARAM]);
+            if (lf) {
+                sel.list.filter = lf;
+            }
         }
         const or = query[OBJECT_RESOURCE_PARAM];
         const on = query[OBJECT_NAME_PARAM];
@@ -100,6 +105,9 @@ export const selection2Path = (sel: Selection): LocationDescriptorObject => {
     if (sel.list) {
         query[LIST_RESOURCE_PARAM] = sel.list.resourceTypes;
         query[LIST_TITLE_PARAM] = sel.list.title || "";
+        if (sel.list.filter) {
+            query[LIST_FILTER_PARAM] = sel.list.filter;
+        }
     }
     if (sel.object) {
         query[OBJECT_RESOURCE_PARAM] = sel.object.resourceType;
@@ -2,6 +2,7 @@ import {routerReducer} from "react-router-redux";
 import {ActionTypes, AppAction} from "../actions";
 import {path2Selection} from "../pathmap";
 import {State} from "../state";
+import {sortContexts} from "../../util";
 
 const shallowCopy = (x) => {
     const copy = {};
@@ -19,6 +20,24 @@ export function rootReducer(old: State, action: AppAction): State {
                 routing: newRouting,
                 selection: path2Selection(loc),
             };
+        case ActionTypes.UI_SAVE_SETTINGS:
+            return {
+                ...old,
+                settingsUpdate: {saving: true},
+            };
+        case ActionTypes.SETTINGS_SAVED:
+            if (action.err) {
+                return {
+                    ...old,
+                    settingsUpdate: {err: action.err},
+                };
+            }
+            return {
+                ...old,
+                availableContexts: sortContexts(old.availableContexts, action.settings.favoriteContexts || []),
+                settings: action.settings,
+                settingsUpdate: {},
+            };
         case ActionTypes.START_CONTEXT_LOAD:
             return {
                 ...old,
@@ -35,6 +54,11 @@ export function rootReducer(old: State, action: AppAction): State {
                 ...old,
                 namespaceCache: action.nl,
             };
+        case ActionTypes.GET_PERMISSIONS:
+            return {
+                ...old,
+                permissionsCache: action.pc,
+            };
         case ActionTypes.START_QUERIES:
             const qd = shallowCopy(old.data);
             action.queries.forEach( (ql) => {
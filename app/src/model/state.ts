@@ -25,6 +25,10 @@ export class State {
     public availableContexts: string[];
     public contextCache?: types.ContextCache;
     public namespaceCache?: types.NamespaceListCache;
+    public permissionsCache?: types.PermissionsCache;
+    public settings?: types.ISettings;
+    public settingsErr?: Error;
+    public settingsUpdate?: types.SettingsUpdate;
     public data: IQueryResultsMap;
     public routing: any;
     public selection: types.Selection;
@@ -58,9 +62,13 @@ export class StateReader {
             return null;
         }
         const resources = state.contextCache.detail.resources;
+        const hidden = (state.settings && state.settings.hiddenKinds) || [];
         const out = [];
         const needCluster = scope === types.QueryScope.CLUSTER_OBJECTS;
         for (const res of resources) {
+            if (hidden.indexOf(res.id.substring(res.id.indexOf(":") + 1)) >= 0) {
+                continue;
+            }
             if (res.isClusterResource === needCluster) {
                 out.push(res);
             }
@@ -152,11 +160,13 @@ export class StateReader {
         const sel = s.selection;
         const ns = sel.namespace;
         const info = StateReader.getResourceInfo(s, resourceType) || {isClusterResource: false};
-        return resourceQueryKey({
+        const key = resourceQueryKey({
             k8sContext: sel.context,
             namespace: !info.isClusterResource && ns.scope === types.QueryScope.SINGLE_NAMESPACE ? ns.namespace : "",
             resourceType,
         });
+        const filter = sel.list && sel.list.filter;
+        return filter ? key + "?filter=" + filter : key;
     }
 
     public static detailQueryKey(s: State) {
@@ -186,11 +196,13 @@ export class StateReader {
 
 export const overviewTitle = "Overview";
 
-export function initialState(ctxList: string[]): State {
+export function initialState(ctxList: string[], settings?: types.ISettings, settingsErr?: Error): State {
     return {
         availableContexts: ctxList,
         data: {},
         routing: routerReducer(undefined, undefined),
         selection: {},
+        settings: settings || {},
+        settingsErr,
     };
 }
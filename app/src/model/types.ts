@@ -14,8 +14,15 @@ export interface IResource {
     status: any;
 }
 
+export interface IStatus {
+    code: number;
+    reason?: string;
+    message: string;
+}
+
 export interface IResourceList {
     items: IResource[];
+    error?: IStatus; // set when the list could only be partially loaded
 }
 
 export interface IContextList {
@@ -44,6 +51,42 @@ export interface IContextDetail {
     aliases: object;
 }
 
+// IPermissionList has the verbs allowed on every resource, keyed by resource ID.
+export interface IPermissionList {
+    namespace: string;
+    user?: string;
+    groups?: string[];
+    incomplete?: boolean;
+    resources: { [id: string]: string[] };
+    errors?: string[];
+}
+
+// IImpersonation is the impersonation for all contexts or a single context.
+export interface IImpersonation {
+    user: string;
+    uid?: string;
+    groups?: string[];
+    extra?: { [key: string]: string[] };
+}
+
+// ISettings are the persistent user settings.
+export interface ISettings {
+    port?: number;
+    kubeconfigFiles?: string[];
+    impersonation?: IImpersonation;
+    contextImpersonation?: { [context: string]: IImpersonation };
+    favoriteContexts?: string[];
+    hiddenKinds?: string[];
+    projectionFiles?: string[];
+    ui?: object;
+}
+
+// SettingsUpdate tracks saving the settings edited in the UI.
+export class SettingsUpdate {
+    public saving?: boolean;
+    public err?: Error;
+}
+
 // ResourceQuery is a query for a list or a single object.
 export class ResourceQuery {
     public k8sContext: string; // context name
@@ -98,6 +141,15 @@ export class ContextCache {
     public err?: Error;
 }
 
+// has the permissions of the user for a context and namespace.
+export class PermissionsCache {
+    public contextName: string;
+    public namespace: string;
+    public loading?: boolean;
+    public permissions?: IPermissionList;
+    public err?: Error;
+}
+
 // has the selected context name and associated details of the context.
 export class NamespaceListCache {
     public contextName: string;
@@ -109,6 +161,7 @@ export class NamespaceListCache {
 export class ListPageSelection {
     public title: string;
     public resourceTypes: string[];
+    public filter?: string; // server-side filter applied to every list
 }
 
 // ObjectSelection is the selection of a single object.
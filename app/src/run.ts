@@ -2,32 +2,38 @@ import {createBrowserHistory} from "history";
 import {routerMiddleware} from "react-router-redux";
 import {applyMiddleware, createStore} from "redux";
 import {createLogger} from "redux-logger";
-import {Client} from "./client";
+import {apiURL, Client} from "./client";
 import {App} from "./components/app";
 import {getMiddleware} from "./model/middleware";
 import {rootReducer} from "./model/reducers";
 import {initialState} from "./model/state";
+import {ISettings} from "./model/types";
+import {sortContexts} from "./util";
 
 export function runApplication(el: string) {
-    const apiURL = window.location.protocol + "//" + window.location.host + "/api/contexts";
-    const client = new Client(apiURL);
-    client.listContexts((err, list) => {
-        if (err) {
-            throw err;
-        }
-        const names = list.items;
-        names.sort();
-        const state = initialState(names);
-        const h = createBrowserHistory();
-        const store = createStore(
-            rootReducer,
-            state,
-            applyMiddleware(
-                ...getMiddleware(client),
-                routerMiddleware(h),
-                createLogger(),
-            ),
-        );
-        App.start(store, h, el);
+    const client = new Client(apiURL());
+    client.getSettings((settingsErr, settings) => {
+        client.listContexts((err, list) => {
+            if (err) {
+                throw err;
+            }
+            const favorites = (settings && settings.favoriteContexts) || [];
+            start(client, el, sortContexts(list.items, favorites), settings, settingsErr);
+        });
     });
 }
+
+const start = (client: Client, el: string, names: string[], settings: ISettings, settingsErr: Error) => {
+    const state = initialState(names, settings, settingsErr);
+    const h = createBrowserHistory();
+    const store = createStore(
+        rootReducer,
+        state,
+        applyMiddleware(
+            ...getMiddleware(client),
+            routerMiddleware(h),
+            createLogger(),
+        ),
+    );
+    App.start(store, h, el);
+};
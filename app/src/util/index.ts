@@ -12,6 +12,12 @@ export function versionlessResourceType(name: string): string {
     return g + "/:" + kind;
 }
 
+// sortContexts sorts context names with favorites first.
+export const sortContexts = (names: string[], favorites: string[]): string[] => {
+    const rank = (name: string) => favorites.indexOf(name) >= 0 ? 0 : 1;
+    return names.slice().sort((a, b) => rank(a) - rank(b) || a.localeCompare(b));
+};
+
 export enum StandardResourceTypes {
     CONFIG_MAP = "/:ConfigMap",
     DAEMONSET = "apps/:DaemonSet",
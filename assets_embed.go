@@ -0,0 +1,25 @@
+//go:build embed
+// +build embed
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// dist is the compiled web app, embedded when building with the embed tag
+// after the front end has been compiled.
+//
+//go:embed dist
+var dist embed.FS
+
+// embeddedAssets returns the embedded web app.
+func embeddedAssets() http.FileSystem {
+	sub, err := fs.Sub(dist, "dist")
+	if err != nil {
+		panic(err)
+	}
+	return http.FS(sub)
+}
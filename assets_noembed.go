@@ -0,0 +1,11 @@
+//go:build !embed
+// +build !embed
+
+package main
+
+import "net/http"
+
+// embeddedAssets returns nil since the web app is not embedded in this build.
+func embeddedAssets() http.FileSystem {
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/getlantern/systray"
+	"github.com/gotwarlost/kui/pkg/kubeconfig"
+	"github.com/gotwarlost/kui/pkg/server"
+	"github.com/gotwarlost/kui/pkg/snapshot"
+)
+
+// commands are the subcommands of kui. Without a subcommand, kui starts the server
+// with a system tray and opens a browser.
+var commands = map[string]func(args []string){
+	"version":  runVersion,
+	"contexts": runContexts,
+	"serve":    runServe,
+	"open":     runOpen,
+	"export":   runExport,
+}
+
+// runVersion prints the version.
+func runVersion(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "usage: kui version")
+		os.Exit(2)
+	}
+	fmt.Println(versionString())
+}
+
+// runContexts lists the contexts in the kubeconfig, marking the current one. The
+// kubeconfig files, or a snapshot, are resolved from the flags as for serve.
+func runContexts(args []string) {
+	headless = true
+	parseFlags("contexts", "kui contexts [flags]", args, 0, nil)
+	cfg, err := contextsConfig()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CURRENT\tNAME\tNAMESPACE")
+	for _, name := range cfg.ContextNames() {
+		current := ""
+		if name == cfg.CurrentContext() {
+			current = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", current, name, cfg.DefaultNamespaceForContext(name))
+	}
+	w.Flush()
+}
+
+// contextsConfig returns the kubeconfig the server would use for the flags and settings.
+func contextsConfig() (*kubeconfig.Config, error) {
+	if snapshotPath != "" {
+		s, err := snapshot.Open(snapshotPath)
+		if err != nil {
+			return nil, err
+		}
+		return s.KubeConfig(), nil
+	}
+	sc, err := serverConfig()
+	if err != nil {
+		return nil, err
+	}
+	return kubeconfig.New(server.KubeConfigFiles(sc.KubeConfigFiles))
+}
+
+// runServe runs the server in the foreground without a system tray or browser.
+func runServe(args []string) {
+	headless = true
+	initialize("serve", "kui serve [flags]", args, 0, nil)
+	if singleInstance() {
+		setInstanceSocket()
+	}
+	handleSignals()
+	onReady()
+	waitForServer()
+}
+
+// runOpen opens a browser on a context and, optionally, a namespace and an object,
+// starting kui if it is not already running.
+func runOpen(args []string) {
+	rest := initialize("open", "kui open [flags] <context> [namespace] [kind[/name]]", args, 3, nil)
+	if len(rest) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: kui open [flags] <context> [namespace] [kind[/name]]")
+		os.Exit(2)
+	}
+	deepLink = strings.Join(rest, "/")
+	run()
+}
+
+// runExport exports a context, or a namespace in it, to a snapshot directory or tarball
+// that can be browsed with --snapshot.
+func runExport(args []string) {
+	const usage = "kui export [flags] <context> [namespace]"
+	var (
+		output         string
+		includeSecrets bool
+	)
+	headless = true
+	rest := initialize("export", usage, args, 2, func(fs *flag.FlagSet) {
+		fs.StringVar(&output, "o", "", "output directory, or tarball if it ends with .tar, .tar.gz or .tgz (default <context>[-<namespace>]-<time>.tar.gz)")
+		fs.BoolVar(&includeSecrets, "include-secrets", false, "export secret data without redaction")
+	})
+	if len(rest) == 0 {
+		fmt.Fprintln(os.Stderr, "usage:", usage)
+		os.Exit(2)
+	}
+	ctx := rest[0]
+	opts := server.ExportOptions{IncludeSecrets: includeSecrets}
+	if len(rest) > 1 {
+		opts.Namespace = rest[1]
+	}
+	if output == "" {
+		output = snapshot.Name(ctx, opts.Namespace, time.Now()) + ".tar.gz"
+	}
+
+	cfg, err := serverConfig()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	h, err := server.New(cfg)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer h.Close()
+	sw, closeOutput, err := exportWriter(output)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	reqCtx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	err = h.Export(reqCtx, ctx, opts, sw)
+	if err == nil {
+		err = sw.Close()
+	}
+	if cerr := closeOutput(err == nil); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Fatalln("export failed,", err)
+	}
+	for _, e := range sw.Metadata().Errors {
+		log.Println("not exported:", e)
+	}
+	fmt.Println(output)
+}
+
+// exportWriter returns a snapshot writer for the output path and a function that
+// closes the output, removing an incomplete tarball.
+func exportWriter(output string) (*snapshot.Writer, func(ok bool) error, error) {
+	gzipped := strings.HasSuffix(output, ".tar.gz") || strings.HasSuffix(output, ".tgz")
+	if !gzipped && !strings.HasSuffix(output, ".tar") {
+		sw, err := snapshot.NewDirWriter(output)
+		return sw, func(bool) error { return nil }, err
+	}
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshot.NewTarWriter(f, gzipped), func(ok bool) error {
+		err := f.Close()
+		if !ok {
+			os.Remove(output)
+		}
+		return err
+	}, nil
+}
+
+// runDefault starts kui with an optional deep link.
+func runDefault(args []string) {
+	rest := initialize("", "kui [flags] [context[/namespace[/kind[/name]]]]", args, 1, nil)
+	if len(rest) > 0 {
+		deepLink = rest[0]
+	}
+	run()
+}
+
+// run hands off to a running instance or starts the server, with a system tray
+// unless running in the foreground.
+func run() {
+	if singleInstance() && handOff() {
+		return
+	}
+	handleSignals()
+	if foreground {
+		onReady()
+		waitForServer()
+		return
+	}
+	systray.Run(onReady, shutdown)
+}
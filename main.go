@@ -1,31 +1,74 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/getlantern/systray"
+	"github.com/gotwarlost/kui/pkg/instance"
+	kuilisten "github.com/gotwarlost/kui/pkg/listen"
 	"github.com/gotwarlost/kui/pkg/server"
+	"github.com/gotwarlost/kui/pkg/userconfig"
 	"github.com/skratchdot/open-golang/open"
 )
 
 var (
 	appDir            string
+	assets            http.FileSystem
 	port              int
 	foreground        bool
 	icon              []byte
 	serverURL         string
+	token             string
 	doneChan          <-chan error
+	apiHandler        server.APIHandler
+	deepLink          string
+	instanceSocket    string
+	headless          bool
 	impersonateUser   string
 	impersonateGroups string
+	impersonateUID    string
+	impersonateExtra  string
+	contextAs         string
+	projectionFiles   string
+	noRedaction       bool
+	enablePprof       bool
+	logLevel          string
+	logFormat         string
+	redactConfigMap   string
+	useTLS            bool
+	socketPath        string
+	snapshotPath      string
+	recordDir         string
+	kubeConfigFiles   string
+	settingsFile      string
+	settings          = &userconfig.Settings{}
+	httpServer        *http.Server
+	runningInstance   *instance.Instance
+	shutdownOnce      sync.Once
+	shutdownDone      = make(chan struct{})
+)
+
+const (
+	readHeaderTimeout = 10 * time.Second
+	idleTimeout       = 2 * time.Minute
+	shutdownTimeout   = 10 * time.Second // time allowed for in-flight requests on shutdown
 )
 
 // Version is the program version.
@@ -40,10 +83,6 @@ func defaultAppDir() string {
 		}
 		return dir
 	}
-	appDir = os.Getenv("KUI_APP_DIR")
-	if appDir != "" {
-		return appDir
-	}
 	exe, err := os.Executable()
 	if err != nil {
 		return ultimateDefault()
@@ -60,29 +99,92 @@ func defaultAppDir() string {
 	return dir
 }
 
-func initialize() {
-	appDir = defaultAppDir()
+// appAssets returns the web app from the app directory, if one is specified using
+// --app-dir or $KUI_APP_DIR. Otherwise it returns the embedded web app, falling back
+// to a dist directory next to the executable for builds without embedded assets.
+func appAssets() (http.FileSystem, error) {
+	dir := appDir
+	if dir == "" {
+		dir = os.Getenv("KUI_APP_DIR")
+	}
+	if dir == "" {
+		if a := embeddedAssets(); a != nil {
+			return a, nil
+		}
+		dir = defaultAppDir()
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get absolute path for %s, %v", dir, err)
+	}
+	if _, err := os.Stat(filepath.Join(abs, "index.html")); err != nil {
+		return nil, fmt.Errorf("unable to find index.html, %v", err)
+	}
+	appDir = abs
+	return http.Dir(abs), nil
+}
 
-	fs := flag.NewFlagSet("kui", flag.ExitOnError)
-	fs.StringVar(&appDir, "app-dir", appDir, "path to webapp directory (from $KUI_APP_DIR, if set)")
-	fs.StringVar(&impersonateUser, "as", "", "user to impersonate")
-	fs.StringVar(&impersonateGroups, "as-group", "", "comma-separated groups to impersonate")
-	fs.IntVar(&port, "port", 11491, "listen port, set to 0 for random port")
-	fs.BoolVar(&foreground, "fore", false, "run server in foreground, no system tray")
-	fs.Parse(os.Args[1:])
+// readAsset returns the contents of a file from the web app.
+func readAsset(name string) ([]byte, error) {
+	f, err := assets.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
 
-	dir, err := filepath.Abs(appDir)
+// loadSettings loads the persistent user settings, which provide the defaults for flags.
+func loadSettings() {
+	file, err := userconfig.SettingsPath()
 	if err != nil {
-		log.Fatalln("unable to get absolute path for", appDir, err)
+		log.Println("unable to locate settings file, using defaults,", err)
+		return
 	}
-	_, err = os.Stat(filepath.Join(appDir, "index.html"))
+	settingsFile = file
+	s, err := userconfig.LoadSettings(file)
 	if err != nil {
-		log.Fatalln("unable to find index.html,", err)
+		// the settings API reports the error to the UI, which shows it when editing settings
+		log.Println("unable to load settings, using defaults,", err)
+		return
+	}
+	settings = s
+}
+
+// setupLogging sets the default logger, which is also used by the standard log package,
+// to log to stderr at the supplied level in the supplied format.
+func setupLogging(level, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	var h slog.Handler
+	switch format {
+	case "text":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %q", format)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// initialize parses the flags for the supplied command, as parseFlags does, loads the
+// web app and returns the positional arguments.
+func initialize(cmd, usage string, args []string, maxArgs int, cmdFlags func(fs *flag.FlagSet)) []string {
+	rest := parseFlags(cmd, usage, args, maxArgs, cmdFlags)
+
+	var err error
+	assets, err = appAssets()
+	if err != nil {
+		log.Fatalln(err)
 	}
-	appDir = dir
 
 	if foreground {
-		return
+		return rest
 	}
 
 	var iconFile string
@@ -95,45 +197,334 @@ func initialize() {
 		iconFile = "k8s.icns"
 	}
 
-	icon, err = ioutil.ReadFile(filepath.Join(appDir, "icons", iconFile))
+	icon, err = readAsset("/icons/" + iconFile)
 	if err != nil {
 		log.Fatalln(err)
 	}
+	return rest
 }
 
-func startServer() (string, <-chan error) {
-	ch := make(chan error, 2)
+// parseFlags parses the server flags, and any flags added by the supplied function,
+// for the supplied command and returns the positional arguments, of which at most
+// maxArgs are allowed.
+func parseFlags(cmd, usage string, args []string, maxArgs int, cmdFlags func(fs *flag.FlagSet)) []string {
+	loadSettings()
+	var defaultImp userconfig.Impersonation
+	if settings.Impersonation != nil {
+		defaultImp = *settings.Impersonation
+	}
+	defaultPort := 11491
+	if settings.Port != 0 {
+		defaultPort = settings.Port
+	}
+
+	fs := flag.NewFlagSet(strings.TrimSpace("kui "+cmd), flag.ExitOnError)
+	fs.StringVar(&kubeConfigFiles, "kubeconfig", strings.Join(settings.KubeConfigFiles, ","), "comma-separated kubeconfig files, empty uses $KUBECONFIG or ~/.kube/config")
+	fs.StringVar(&appDir, "app-dir", "", "path to webapp directory for development (default $KUI_APP_DIR, then the embedded app)")
+	fs.StringVar(&impersonateUser, "as", defaultImp.User, "user to impersonate")
+	fs.StringVar(&impersonateGroups, "as-group", strings.Join(defaultImp.Groups, ","), "comma-separated groups to impersonate")
+	fs.StringVar(&impersonateUID, "as-uid", defaultImp.UID, "uid to impersonate")
+	fs.StringVar(&impersonateExtra, "as-extra", "", "comma-separated key=value extra values to impersonate")
+	fs.StringVar(&contextAs, "context-as", "", "comma-separated context=user pairs to impersonate for specific contexts")
+	fs.StringVar(&projectionFiles, "projections", strings.Join(settings.ProjectionFiles, ","), "comma-separated YAML files with additional list projections")
+	fs.BoolVar(&noRedaction, "no-redact", false, "show secret data without redaction")
+	fs.BoolVar(&enablePprof, "pprof", false, "serve runtime profiles under /debug/pprof/")
+	fs.StringVar(&logLevel, "log-level", "info", "log level, one of debug, info, warn or error")
+	fs.StringVar(&logFormat, "log-format", "text", "log format, one of text or json")
+	fs.StringVar(&redactConfigMap, "redact-configmap-keys", "", "comma-separated regular expressions for config map keys to redact")
+	fs.IntVar(&port, "port", defaultPort, "listen port, set to 0 for random port")
+	fs.BoolVar(&useTLS, "tls", false, "serve HTTPS using a self-signed certificate cached in the user config directory")
+	fs.StringVar(&socketPath, "socket", "", "serve on a Unix domain socket at this path instead of TCP, implies --fore")
+	fs.BoolVar(&foreground, "fore", false, "run server in foreground, no system tray")
+	fs.StringVar(&snapshotPath, "snapshot", "", "serve a kui snapshot or kubectl cluster-info dump directory or tarball instead of live clusters")
+	fs.StringVar(&recordDir, "record", "", "save Kubernetes API requests and responses, including secret data, to this directory as test fixtures")
+	if cmdFlags != nil {
+		cmdFlags(fs)
+	}
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage:", usage)
+		if cmd == "" {
+			fmt.Fprintln(os.Stderr, "       kui version|contexts|serve|open|export ...")
+		}
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > maxArgs {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := setupLogging(logLevel, logFormat); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fs.Usage()
+		os.Exit(2)
+	}
+	if socketPath != "" || headless {
+		foreground = true
+	}
+	// snapshots are served by a separate instance that does not take over the default port
+	if snapshotPath != "" {
+		portSet := false
+		fs.Visit(func(f *flag.Flag) {
+			portSet = portSet || f.Name == "port"
+		})
+		if !portSet {
+			port = 0
+		}
+	}
+	return fs.Args()
+}
+
+// listen returns the listener for the server and its base URL.
+func listen() (net.Listener, string, error) {
+	if socketPath != "" {
+		l, err := kuilisten.Unix(socketPath)
+		if err != nil {
+			return nil, "", err
+		}
+		return l, "unix://" + socketPath, nil
+	}
 	l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
 	if err != nil {
-		ch <- err
-		return "", ch
+		return nil, "", err
 	}
-	addr := l.Addr()
-	log.Println("listening on", addr)
+	scheme := "http"
+	if useTLS {
+		dir, err := userconfig.Dir()
+		if err != nil {
+			l.Close()
+			return nil, "", err
+		}
+		tc, err := kuilisten.TLSConfig(filepath.Join(dir, "tls"))
+		if err != nil {
+			l.Close()
+			return nil, "", err
+		}
+		l = tls.NewListener(l, tc)
+		scheme = "https"
+	}
+	return l, fmt.Sprintf("%s://%s", scheme, l.Addr().String()), nil
+}
+
+// serverConfig returns the server configuration for the flags and settings.
+func serverConfig() (server.Config, error) {
 	imp := server.Impersonation{
 		User: impersonateUser,
+		UID:  impersonateUID,
 	}
 	if impersonateGroups != "" {
 		imp.Groups = strings.Split(impersonateGroups, ",")
 	}
+	if settings.Impersonation != nil && impersonateUser == settings.Impersonation.User {
+		imp.Extra = settings.Impersonation.Extra
+	}
+	if impersonateExtra != "" {
+		imp.Extra = map[string][]string{}
+		for _, kv := range strings.Split(impersonateExtra, ",") {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 {
+				return server.Config{}, fmt.Errorf("invalid --as-extra value %q, must be key=value", kv)
+			}
+			imp.Extra[parts[0]] = append(imp.Extra[parts[0]], parts[1])
+		}
+	}
+	contextImp := map[string]server.Impersonation{}
+	for ctx, ci := range settings.ContextImpersonation {
+		contextImp[ctx] = server.Impersonation(ci)
+	}
+	if contextAs != "" {
+		for _, cu := range strings.Split(contextAs, ",") {
+			parts := strings.SplitN(cu, "=", 2)
+			if len(parts) != 2 {
+				return server.Config{}, fmt.Errorf("invalid --context-as value %q, must be context=user", cu)
+			}
+			contextImp[parts[0]] = server.Impersonation{User: parts[1]}
+		}
+	}
 	cfg := server.Config{
-		StaticRoot:    appDir,
-		Impersonation: imp,
-		UserAgent:     "kui/1.0 (" + runtime.GOOS + "/" + runtime.GOARCH + ")", // FIXME for real version
+		StaticRoot:           appDir,
+		Assets:               assets,
+		Impersonation:        imp,
+		ContextImpersonation: contextImp,
+		UserAgent:            userAgent(),
+		SettingsFile:         settingsFile,
+	}
+	if kubeConfigFiles != "" {
+		cfg.KubeConfigFiles = strings.Split(kubeConfigFiles, ",")
+	}
+	if projectionFiles != "" {
+		cfg.ProjectionFiles = strings.Split(projectionFiles, ",")
 	}
+	cfg.NoRedaction = noRedaction
+	cfg.Pprof = enablePprof
+	cfg.Snapshot = snapshotPath
+	cfg.Record = recordDir
+	if redactConfigMap != "" {
+		cfg.RedactConfigMapKeys = strings.Split(redactConfigMap, ",")
+	}
+	return cfg, nil
+}
+
+func startServer() (string, <-chan error) {
+	ch := make(chan error, 2)
+	l, u, err := listen()
+	if err != nil {
+		ch <- err
+		return "", ch
+	}
+	log.Println("listening on", u)
+	cfg, err := serverConfig()
+	if err != nil {
+		ch <- err
+		return "", ch
+	}
+	// access to the socket is restricted by file permissions, so no token is needed
+	if socketPath == "" {
+		token, err = server.NewToken()
+		if err != nil {
+			ch <- err
+			return "", ch
+		}
+	}
+	cfg.Token = token
 	handler, err := server.New(cfg)
 	if err != nil {
 		ch <- err
 		return "", ch
 	}
+	apiHandler = handler
+	httpServer = &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		IdleTimeout:       idleTimeout,
+	}
 	go func() {
-		ch <- http.Serve(l, handler)
+		err := httpServer.Serve(l)
+		if err == http.ErrServerClosed {
+			err = nil
+		}
+		ch <- err
 	}()
-	return fmt.Sprintf("http://%s", addr.String()), ch
+	return u, ch
 }
 
 func openBrowser() {
-	u := serverURL
+	openBrowserAt(startPath())
+}
+
+// startPath returns the path to open initially, which is the deep link from the
+// command line, if any.
+func startPath() string {
+	if deepLink == "" {
+		return "/"
+	}
+	var parts []string
+	for _, p := range strings.Split(strings.Trim(deepLink, "/"), "/") {
+		parts = append(parts, url.PathEscape(p))
+	}
+	return "/open/" + strings.Join(parts, "/")
+}
+
+// setInstanceSocket sets the path of the socket used for the single instance check
+// and returns false if it cannot be determined.
+func setInstanceSocket() bool {
+	dir, err := userconfig.RuntimeDir()
+	if err != nil {
+		log.Println("unable to get runtime directory, single instance check disabled,", err)
+		return false
+	}
+	instanceSocket = filepath.Join(dir, "instance.sock")
+	return true
+}
+
+// singleInstance returns true if this instance takes part in the single instance
+// check. Instances on a Unix socket or serving a snapshot run independently.
+func singleInstance() bool {
+	return socketPath == "" && snapshotPath == ""
+}
+
+// handOff asks a running instance to open a browser at the start path and returns
+// true if it did.
+func handOff() bool {
+	if !setInstanceSocket() {
+		return false
+	}
+	if err := instance.Notify(instanceSocket, instance.Request{Open: startPath()}); err != nil {
+		return false
+	}
+	log.Println("opened a browser window from the running instance")
+	return true
+}
+
+// acquireInstance makes this process the running instance that opens browser windows
+// for later invocations.
+func acquireInstance() {
+	if instanceSocket == "" {
+		return
+	}
+	inst, err := instance.Acquire(instanceSocket, func(req instance.Request) error {
+		openBrowserAt(req.Open)
+		return nil
+	})
+	if err != nil {
+		log.Println("single instance check disabled,", err)
+		return
+	}
+	runningInstance = inst
+}
+
+// shutdown stops accepting requests, waits for in-flight requests to complete for
+// a limited time and releases all connections. It may be called more than once.
+func shutdown() {
+	shutdownOnce.Do(func() {
+		defer close(shutdownDone)
+		if runningInstance != nil {
+			runningInstance.Close()
+		}
+		if httpServer == nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			log.Println("shutdown: closing remaining connections,", err)
+			httpServer.Close()
+		}
+		apiHandler.Close()
+		log.Println("shutdown complete")
+	})
+}
+
+// handleSignals shuts down on an interrupt or termination signal. In tray mode the
+// tray is quit, which shuts down the server. A second signal exits immediately.
+func handleSignals() {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		log.Println("received", sig, "shutting down")
+		go func() {
+			<-sigs
+			os.Exit(1)
+		}()
+		if foreground {
+			shutdown()
+			return
+		}
+		systray.Quit()
+	}()
+}
+
+// waitForServer waits for the server to stop and for shutdown to complete.
+func waitForServer() {
+	if err := <-doneChan; err != nil {
+		log.Fatalln(err)
+	}
+	<-shutdownDone
+}
+
+// openBrowserAt opens a browser on the supplied path of the server.
+func openBrowserAt(path string) {
+	u := serverURL + path + "?token=" + token
 	if err := open.Run(u); err != nil {
 		log.Println("error opening browser:", err, ", open", u, "manually")
 	}
@@ -149,33 +540,47 @@ func onReady() {
 	}
 	serverURL = u
 	doneChan = done
+	if singleInstance() {
+		acquireInstance()
+	}
 
 	if !foreground {
 		systray.SetTooltip("Kubernetes UI")
 		systray.SetIcon(icon)
 		ob := systray.AddMenuItem("New browser window", fmt.Sprintf("opens a browser to %s where the KUI server is listening", serverURL))
+		cm := newContextMenu(apiHandler)
 		systray.AddSeparator()
 		eb := systray.AddMenuItem("Quit", "quit kui")
 		go func() {
 			for range ob.ClickedCh {
-				openBrowser()
+				openBrowserAt("/")
 			}
 		}()
 		go func() {
 			<-eb.ClickedCh
 			systray.Quit()
 		}()
+		go cm.watch()
+	}
+	if headless {
+		if socketPath == "" {
+			log.Println("open", serverURL+"/?token="+token)
+		}
+		return
+	}
+	if socketPath == "" {
+		openBrowser()
 	}
-	openBrowser()
 }
 
 func main() {
 	runtime.LockOSThread()
-	initialize()
-	if foreground {
-		onReady()
-		err := <-doneChan
-		log.Fatalln(err)
+	args := os.Args[1:]
+	if len(args) > 0 {
+		if cmd, ok := commands[args[0]]; ok {
+			cmd(args[1:])
+			return
+		}
 	}
-	systray.Run(onReady, func() {})
+	runDefault(args)
 }
@@ -0,0 +1,127 @@
+// Package instance ensures that a single kui instance runs for a user and allows
+// later invocations to hand off requests to it.
+package instance
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gotwarlost/kui/pkg/listen"
+	"github.com/pkg/errors"
+)
+
+// ErrRunning is returned by Acquire when another instance owns the socket.
+var ErrRunning = errors.New("another kui instance is running")
+
+const requestTimeout = 5 * time.Second
+
+// Request is a request sent by a later invocation to the running instance.
+type Request struct {
+	Open string `json:"open"` // the server path to open in a browser
+}
+
+// validate returns an error if the request cannot be handled.
+func (r Request) validate() error {
+	if !strings.HasPrefix(r.Open, "/") || strings.HasPrefix(r.Open, "//") {
+		return errors.Errorf("invalid path %q", r.Open)
+	}
+	return nil
+}
+
+// response is the reply of the running instance.
+type response struct {
+	Error string `json:"error,omitempty"`
+}
+
+// Instance is the running instance that handles requests from later invocations.
+type Instance struct {
+	l  net.Listener
+	fn func(Request) error
+}
+
+// Acquire makes the current process the running instance by listening on the socket
+// at the supplied path. Requests are handled by the supplied function. It returns
+// ErrRunning if another instance is already listening.
+func Acquire(path string, fn func(Request) error) (*Instance, error) {
+	if c, err := net.Dial("unix", path); err == nil {
+		c.Close()
+		return nil, ErrRunning
+	}
+	l, err := listen.Unix(path)
+	if err != nil {
+		return nil, err
+	}
+	i := &Instance{l: l, fn: fn}
+	go i.serve()
+	return i, nil
+}
+
+// Close stops handling requests and removes the socket.
+func (i *Instance) Close() error {
+	return i.l.Close()
+}
+
+func (i *Instance) serve() {
+	for {
+		c, err := i.l.Accept()
+		if err != nil {
+			return
+		}
+		go i.handle(c)
+	}
+}
+
+func (i *Instance) handle(c net.Conn) {
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(requestTimeout))
+	var req Request
+	var resp response
+	line, err := bufio.NewReader(c).ReadBytes('\n')
+	if err == io.EOF && len(line) == 0 {
+		return // a probe from Acquire
+	}
+	if err == nil {
+		err = json.Unmarshal(line, &req)
+	}
+	if err == nil {
+		err = req.validate()
+	}
+	if err == nil {
+		err = i.fn(req)
+	}
+	if err != nil {
+		log.Println("instance: request failed,", err)
+		resp.Error = err.Error()
+	}
+	json.NewEncoder(c).Encode(resp)
+}
+
+// Notify sends the request to the instance listening on the socket at the supplied
+// path. An error is returned if no instance is running or the request failed.
+func Notify(path string, req Request) error {
+	if err := req.validate(); err != nil {
+		return err
+	}
+	c, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(requestTimeout))
+	if err := json.NewEncoder(c).Encode(req); err != nil {
+		return err
+	}
+	var resp response
+	if err := json.NewDecoder(c).Decode(&resp); err != nil {
+		return errors.Wrap(err, "read response")
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	return nil
+}
@@ -30,7 +30,12 @@ func New(kcFiles []string) (*Config, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "get raw config")
 	}
+	return FromRaw(c), nil
+}
 
+// FromRaw returns a configuration for a kubeconfig that has already been loaded
+// or was constructed in memory.
+func FromRaw(c api.Config) *Config {
 	var names []string
 	m := map[string]bool{}
 	if c.Contexts != nil {
@@ -44,7 +49,7 @@ func New(kcFiles []string) (*Config, error) {
 		rc:      c,
 		names:   names,
 		nameMap: m,
-	}, nil
+	}
 }
 
 // ContextNames returns a list of context names available in the k8s config.
@@ -0,0 +1,173 @@
+// Package listen provides TLS and Unix domain socket listeners for the kui server.
+package listen
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	certFile     = "cert.pem"
+	keyFile      = "key.pem"
+	certValidity = 365 * 24 * time.Hour
+	renewBefore  = 7 * 24 * time.Hour // regenerate certificates that expire sooner than this
+)
+
+// certHosts are the host names and addresses for which the certificate is valid.
+var certHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// TLSConfig returns a TLS config with a self-signed certificate for the loopback
+// interface. The certificate and key are cached in the supplied directory and
+// regenerated when missing, invalid or about to expire.
+func TLSConfig(dir string) (*tls.Config, error) {
+	cf, kf := filepath.Join(dir, certFile), filepath.Join(dir, keyFile)
+	cert, err := loadCert(cf, kf)
+	if err != nil {
+		if err := generateCert(cf, kf); err != nil {
+			return nil, errors.Wrap(err, "generate certificate")
+		}
+		if cert, err = loadCert(cf, kf); err != nil {
+			return nil, err
+		}
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// loadCert loads the cached certificate, returning an error if it is about to expire.
+func loadCert(cf, kf string) (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(cf, kf)
+	if err != nil {
+		return cert, err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return cert, err
+	}
+	if time.Now().Add(renewBefore).After(leaf.NotAfter) {
+		return cert, errors.New("certificate expires soon")
+	}
+	return cert, nil
+}
+
+// generateCert generates a self-signed certificate and key and writes them to the
+// supplied files. The key is only readable by the owner.
+func generateCert(cf, kf string) error {
+	if err := os.MkdirAll(filepath.Dir(cf), 0700); err != nil {
+		return err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	tmpl := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"kui"}, CommonName: "localhost"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, h := range certHosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(kf, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(cf, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+// Unix returns a listener on a Unix domain socket at the supplied path that is
+// only accessible by the owner. A stale socket left behind by a previous run is
+// removed. The socket is created in a private directory and only moved to the path
+// once its mode has been changed, such that other users can never connect to it.
+func Unix(path string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, errors.Errorf("%s exists and is not a socket", path)
+		}
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return nil, errors.Errorf("%s is in use by another process", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempDir(dir, ".kui")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	tmpPath := filepath.Join(tmp, filepath.Base(path))
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmpPath, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	l.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmpPath, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return &unixListener{UnixListener: l, path: path}, nil
+}
+
+// unixListener is a listener on a socket that was moved after it was created. It
+// reports and removes the socket at its final path.
+type unixListener struct {
+	*net.UnixListener
+	path string
+}
+
+// Addr returns the address of the socket at its final path.
+func (l *unixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+// Close closes the listener and removes the socket.
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	os.Remove(l.path)
+	return err
+}
@@ -0,0 +1,57 @@
+//go:build !windows
+// +build !windows
+
+package listen
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kui-listen")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "run", "kui.sock")
+
+	l, err := Unix(path)
+	require.Nil(t, err)
+	fi, err := os.Stat(path)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+	fi, err = os.Stat(filepath.Dir(path))
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0700), fi.Mode().Perm())
+	require.Equal(t, path, l.Addr().String())
+	// the private directory the socket was created in is removed
+	entries, err := ioutil.ReadDir(filepath.Dir(path))
+	require.Nil(t, err)
+	require.Equal(t, 1, len(entries))
+
+	_, err = Unix(path)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "in use by another process")
+	require.Nil(t, l.Close())
+	_, err = os.Lstat(path)
+	require.True(t, os.IsNotExist(err))
+
+	// a stale socket is replaced
+	stale, err := net.Listen("unix", path)
+	require.Nil(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.Nil(t, stale.Close())
+	l, err = Unix(path)
+	require.Nil(t, err)
+	require.Nil(t, l.Close())
+
+	file := filepath.Join(dir, "file")
+	require.Nil(t, ioutil.WriteFile(file, nil, 0600))
+	_, err = Unix(file)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "is not a socket")
+}
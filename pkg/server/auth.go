@@ -0,0 +1,126 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	tokenQueryParam = "token"
+	tokenCookieName = "kui_token"
+)
+
+// loopbackHosts are the host names accepted in the Host header. Any other name
+// is rejected to prevent DNS rebinding attacks.
+var loopbackHosts = map[string]bool{
+	"localhost": true,
+	"127.0.0.1": true,
+	"::1":       true,
+}
+
+// NewToken returns a random token suitable for authenticating API requests.
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hostName returns the host of a host:port string, without the port.
+func hostName(hostPort string) string {
+	host, _, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return strings.Trim(hostPort, "[]")
+	}
+	return host
+}
+
+// isSafeMethod returns true for methods that do not change any state.
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// checkOrigin returns true if the origin of the request, if any, is the server
+// itself. Requests that change state must have an origin or a referer.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		return isSafeMethod(r.Method)
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host
+}
+
+// authenticator wraps a handler and rejects requests that do not have the
+// per-launch token, either as a cookie or as a bearer token. A request with
+// a valid token query parameter sets the cookie and is redirected to the same
+// URL without the token.
+type authenticator struct {
+	token    string
+	delegate http.Handler
+}
+
+// validToken returns true if the supplied token matches the expected one.
+func (a *authenticator) validToken(t string) bool {
+	return t != "" && subtle.ConstantTimeCompare([]byte(t), []byte(a.token)) == 1
+}
+
+// requestToken returns the token presented by the request.
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if c, err := r.Cookie(tokenCookieName); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// ServeHTTP implements the handler interface.
+func (a *authenticator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !loopbackHosts[hostName(r.Host)] {
+		writeErrorMessage(w, 403, reasonForbidden, "invalid host: "+r.Host)
+		return
+	}
+	if !checkOrigin(r) {
+		writeErrorMessage(w, 403, reasonForbidden, "cross-origin request rejected")
+		return
+	}
+	q := r.URL.Query()
+	if t := q.Get(tokenQueryParam); t != "" && isSafeMethod(r.Method) {
+		if !a.validToken(t) {
+			writeErrorMessage(w, 401, reasonUnauthorized, "invalid token")
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     tokenCookieName,
+			Value:    t,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteStrictMode,
+		})
+		q.Del(tokenQueryParam)
+		u := *r.URL
+		u.RawQuery = q.Encode()
+		http.Redirect(w, r, u.RequestURI(), http.StatusFound)
+		return
+	}
+	if !a.validToken(requestToken(r)) {
+		writeErrorMessage(w, 401, reasonUnauthorized, "missing or invalid token, open kui from the system tray or the URL printed at startup")
+		return
+	}
+	a.delegate.ServeHTTP(w, r)
+}
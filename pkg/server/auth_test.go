@@ -0,0 +1,84 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAuthenticator() *authenticator {
+	return &authenticator{
+		token: "secret",
+		delegate: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}),
+	}
+}
+
+func serveAuth(a *authenticator, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	a.ServeHTTP(w, r)
+	return w
+}
+
+func TestAuthTokenCookie(t *testing.T) {
+	a := newTestAuthenticator()
+
+	w := serveAuth(a, httptest.NewRequest("GET", "http://127.0.0.1:11491/api/contexts", nil))
+	require.Equal(t, 401, w.Code)
+
+	w = serveAuth(a, httptest.NewRequest("GET", "http://127.0.0.1:11491/?token=wrong", nil))
+	require.Equal(t, 401, w.Code)
+
+	w = serveAuth(a, httptest.NewRequest("GET", "http://127.0.0.1:11491/ui/foo?token=secret&x=1", nil))
+	require.Equal(t, 302, w.Code)
+	require.Equal(t, "/ui/foo?x=1", w.Header().Get("Location"))
+	cookies := w.Result().Cookies()
+	require.Equal(t, 1, len(cookies))
+	require.Equal(t, tokenCookieName, cookies[0].Name)
+	require.True(t, cookies[0].HttpOnly)
+
+	r := httptest.NewRequest("GET", "http://127.0.0.1:11491/api/contexts", nil)
+	r.AddCookie(cookies[0])
+	w = serveAuth(a, r)
+	require.Equal(t, 200, w.Code)
+	require.Equal(t, "ok", w.Body.String())
+
+	r = httptest.NewRequest("GET", "http://localhost:11491/api/contexts", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w = serveAuth(a, r)
+	require.Equal(t, 200, w.Code)
+}
+
+func TestAuthHostAndOrigin(t *testing.T) {
+	a := newTestAuthenticator()
+
+	r := httptest.NewRequest("GET", "http://evil.example.com:11491/api/contexts", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w := serveAuth(a, r)
+	require.Equal(t, 403, w.Code)
+
+	r = httptest.NewRequest("GET", "http://127.0.0.1:11491/api/contexts", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set("Origin", "http://evil.example.com")
+	w = serveAuth(a, r)
+	require.Equal(t, 403, w.Code)
+
+	r = httptest.NewRequest("GET", "http://127.0.0.1:11491/api/contexts", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set("Origin", "http://127.0.0.1:11491")
+	w = serveAuth(a, r)
+	require.Equal(t, 200, w.Code)
+
+	r = httptest.NewRequest("POST", "http://127.0.0.1:11491/api/contexts", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w = serveAuth(a, r)
+	require.Equal(t, 403, w.Code)
+
+	r = httptest.NewRequest("GET", "http://[::1]:11491/api/contexts", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w = serveAuth(a, r)
+	require.Equal(t, 200, w.Code)
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gotwarlost/kui/pkg/registry"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryCache(t *testing.T) {
+	s := &server{regMap: map[string]cachedRegistry{}}
+	rr := &registry.ResourceRegistry{}
+	s.setCachedRegistry("dev", rr)
+	require.True(t, s.getCachedRegistry("dev") == rr)
+	require.Nil(t, s.getCachedRegistry("prod"))
+
+	// a fresh registry is not re-discovered for unknown resources
+	require.False(t, s.expireRegistry("dev"))
+	require.True(t, s.getCachedRegistry("dev") == rr)
+
+	s.regMap["dev"] = cachedRegistry{rr: rr, loaded: time.Now().Add(-registryMinRefresh)}
+	require.True(t, s.expireRegistry("dev"))
+	require.Nil(t, s.getCachedRegistry("dev"))
+	require.False(t, s.expireRegistry("dev"))
+
+	s.regMap["dev"] = cachedRegistry{rr: rr, loaded: time.Now().Add(-registryTTL)}
+	require.Nil(t, s.getCachedRegistry("dev"))
+
+	s.setCachedRegistry("dev", rr)
+	s.setCachedConfig(nil)
+	require.Nil(t, s.getCachedRegistry("dev"))
+}
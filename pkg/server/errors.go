@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// error reasons for errors generated by the server itself.
+const (
+	reasonConfigError     = "ConfigError"     // kubeconfig could not be loaded
+	reasonBadRequest      = "BadRequest"      // invalid request parameters
+	reasonUnauthorized    = "Unauthorized"    // missing or invalid API token
+	reasonForbidden       = "Forbidden"       // invalid host or cross-origin request
+	reasonRegistryError   = "RegistryError"   // resource discovery failed
+	reasonConnectionError = "ConnectionError" // connection setup or downstream request failed
+	reasonNotFound        = "NotFound"        // requested item not found
+	reasonStreamError     = "StreamError"     // a response failed after it was partially written
+	reasonInternalError   = "InternalError"   // any other error
+)
+
+// maxErrorBody is the maximum size of an upstream error body that is read.
+const maxErrorBody = 1 << 20
+
+// APIError is the error returned for all failed API calls. It has the same shape
+// as a Kubernetes Status object such that errors from the server and from the
+// Kubernetes API may be handled in the same way.
+type APIError struct {
+	Kind    string          `json:"kind"`              // always "Status"
+	Status  string          `json:"status"`            // always "Failure"
+	Code    int             `json:"code"`              // the HTTP status code
+	Reason  string          `json:"reason,omitempty"`  // machine-readable reason
+	Message string          `json:"message"`           // human-readable message
+	Details json.RawMessage `json:"details,omitempty"` // details from the Kubernetes status, if any
+}
+
+// Error implements the error interface.
+func (e APIError) Error() string {
+	return e.Message
+}
+
+// writeAPIError writes the supplied error as JSON with its code as the status.
+func writeAPIError(w http.ResponseWriter, e APIError) {
+	e.Kind = "Status"
+	e.Status = "Failure"
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Code)
+	enc := json.NewEncoder(w)
+	enc.Encode(e)
+}
+
+// writeError writes a server error with the supplied code and reason.
+func writeError(w http.ResponseWriter, code int, reason string, err error) {
+	writeAPIError(w, APIError{Code: code, Reason: reason, Message: err.Error()})
+}
+
+// writeErrorMessage writes a server error with the supplied code, reason and message.
+func writeErrorMessage(w http.ResponseWriter, code int, reason string, message string) {
+	writeAPIError(w, APIError{Code: code, Reason: reason, Message: message})
+}
+
+// writeDownstreamError writes an error returned from a downstream call, preserving
+// the status of Kubernetes API errors.
+func writeDownstreamError(w http.ResponseWriter, err error) {
+	if e, ok := err.(APIError); ok {
+		writeAPIError(w, e)
+		return
+	}
+	writeError(w, 502, reasonConnectionError, err)
+}
+
+// statusFromResponse returns an API error for the supplied unsuccessful upstream
+// response, using the Kubernetes Status object in the body if there is one.
+func statusFromResponse(code int, body io.Reader) APIError {
+	b, _ := ioutil.ReadAll(io.LimitReader(body, maxErrorBody))
+	var st APIError
+	if err := json.Unmarshal(b, &st); err == nil && st.Kind == "Status" {
+		st.Code = code
+		if st.Message == "" {
+			st.Message = http.StatusText(code)
+		}
+		return st
+	}
+	msg := strings.TrimSpace(string(b))
+	if msg == "" {
+		msg = http.StatusText(code)
+	}
+	return APIError{Code: code, Reason: http.StatusText(code), Message: msg}
+}
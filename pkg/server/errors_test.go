@@ -0,0 +1,38 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusFromResponse(t *testing.T) {
+	body := `{"kind":"Status","apiVersion":"v1","metadata":{},"status":"Failure",
+"message":"pods \"foo\" is forbidden","reason":"Forbidden","details":{"name":"foo","kind":"pods"},"code":403}`
+	st := statusFromResponse(403, strings.NewReader(body))
+	require.Equal(t, 403, st.Code)
+	require.Equal(t, "Forbidden", st.Reason)
+	require.Equal(t, `pods "foo" is forbidden`, st.Message)
+	require.JSONEq(t, `{"name":"foo","kind":"pods"}`, string(st.Details))
+
+	st = statusFromResponse(502, strings.NewReader("bad gateway\n"))
+	require.Equal(t, 502, st.Code)
+	require.Equal(t, "bad gateway", st.Message)
+
+	st = statusFromResponse(500, strings.NewReader(""))
+	require.Equal(t, "Internal Server Error", st.Message)
+}
+
+func TestWriteError(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeError(w, 500, reasonConfigError, fmt.Errorf("no config"))
+	require.Equal(t, 500, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var e APIError
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &e))
+	require.Equal(t, APIError{Kind: "Status", Status: "Failure", Code: 500, Reason: reasonConfigError, Message: "no config"}, e)
+}
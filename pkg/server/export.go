@@ -0,0 +1,214 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/dimfeld/httptreemux"
+	"github.com/gotwarlost/kui/pkg/kubeconfig"
+	"github.com/gotwarlost/kui/pkg/registry"
+	"github.com/gotwarlost/kui/pkg/snapshot"
+)
+
+// exportSecretsQueryParam includes secret data in an export when set to exportSecretsInclude.
+const (
+	exportSecretsQueryParam = "secrets"
+	exportSecretsInclude    = "include"
+)
+
+// ExportOptions are the options for exporting a context to a snapshot.
+type ExportOptions struct {
+	Namespace      string // the namespace to export, empty for the whole context
+	IncludeSecrets bool   // export secret data without redaction
+}
+
+// discoveryVersions is the part of the /api discovery document used for exports.
+type discoveryVersions struct {
+	Versions []string `json:"versions"`
+}
+
+// discoveryGroups is the part of the /apis discovery document used for exports.
+type discoveryGroups struct {
+	Groups []struct {
+		Versions []struct {
+			GroupVersion string `json:"groupVersion"`
+		} `json:"versions"`
+	} `json:"groups"`
+}
+
+// export saves the discovery documents of all group versions and the lists of all
+// resources of a context, or of a namespace in the context, to a snapshot. Responses
+// that cannot be read, for example because access is forbidden, are recorded as
+// errors in the snapshot. An error is only returned if the snapshot cannot be
+// written or the request is cancelled.
+func (s *server) export(reqCtx context.Context, cfg *kubeconfig.Config, ctx string, rr *registry.ResourceRegistry, c *conn, opts ExportOptions, sw *snapshot.Writer) error {
+	ns := opts.Namespace
+	defaultNamespace := ns
+	if defaultNamespace == "" {
+		defaultNamespace = cfg.DefaultNamespaceForContext(ctx)
+	}
+	dir := sw.AddContext(ctx, defaultNamespace)
+	sw.SetRedacted(!opts.IncludeSecrets)
+	rd := &redactor{disabled: true}
+	if !opts.IncludeSecrets {
+		rd = &redactor{}
+		if s.redactor != nil {
+			rd.configMapKeys = s.redactor.configMapKeys
+		}
+	}
+
+	// fetch saves the response for a path, decoding it into v if supplied and
+	// redacting it for the supplied object type.
+	fetch := func(p string, v interface{}, objType string) error {
+		b, err := c.getBytes(reqCtx, p)
+		if err == nil && v != nil {
+			err = json.Unmarshal(b, v)
+		}
+		if err == nil && rd.applies(objType) {
+			b, err = rd.redact(bytes.NewReader(b), objType)
+		}
+		if err != nil {
+			if reqCtx.Err() != nil {
+				return reqCtx.Err()
+			}
+			sw.AddError(fmt.Sprintf("%s: %v", p, err))
+			return nil
+		}
+		return sw.WriteResponse(dir, p, b)
+	}
+
+	var versions discoveryVersions
+	if err := fetch("/api", &versions, ""); err != nil {
+		return err
+	}
+	for _, v := range versions.Versions {
+		if err := fetch("/api/"+v, nil, ""); err != nil {
+			return err
+		}
+	}
+	var groups discoveryGroups
+	if err := fetch("/apis", &groups, ""); err != nil {
+		return err
+	}
+	for _, g := range groups.Groups {
+		for _, v := range g.Versions {
+			if err := fetch("/apis/"+v.GroupVersion, nil, ""); err != nil {
+				return err
+			}
+		}
+	}
+
+	if ns != "" {
+		// the namespace is saved as a list with a single item, such that it can be selected
+		p := "/api/v1/namespaces/" + ns
+		b, err := c.getBytes(reqCtx, p)
+		if err == nil {
+			b, err = json.Marshal(map[string]interface{}{
+				"kind":       "NamespaceList",
+				"apiVersion": "v1",
+				"metadata":   map[string]interface{}{},
+				"items":      []json.RawMessage{b},
+			})
+		}
+		if err == nil {
+			err = sw.WriteResponse(dir, "/api/v1/namespaces", b)
+		} else if reqCtx.Err() == nil {
+			sw.AddError(fmt.Sprintf("%s: %v", p, err))
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, ri := range rr.AllResources() {
+		if ns != "" && ri.IsClusterResource {
+			continue
+		}
+		if err := fetch(ri.APIListPath(ns), nil, ri.Key.WithEmptyVersion().String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Export exports a context, or a namespace in the context, to a snapshot using the
+// impersonation configured for the context. The caller must close the writer.
+func (s *server) Export(reqCtx context.Context, ctx string, opts ExportOptions, sw *snapshot.Writer) error {
+	cfg, err := s.getConfig()
+	if err != nil {
+		return err
+	}
+	if !cfg.IsValidContext(ctx) {
+		return fmt.Errorf("invalid context: %s", ctx)
+	}
+	rr, err := s.getRegistry(cfg, ctx)
+	if err != nil {
+		return err
+	}
+	c, err := s.getConn(cfg, ctx, s.configuredImpersonation(ctx))
+	if err != nil {
+		return err
+	}
+	return s.export(reqCtx, cfg, ctx, rr, c, opts, sw)
+}
+
+// exportSnapshot streams a gzipped snapshot tarball of a context, or of the
+// namespace in the query.
+func (s *server) exportSnapshot(w http.ResponseWriter, r *http.Request) {
+	p := httptreemux.ContextParams(r.Context())
+	cfg, err := s.getConfig()
+	if err != nil {
+		writeError(w, 500, reasonConfigError, err)
+		return
+	}
+	ctx := p[contextParamName]
+	if !cfg.IsValidContext(ctx) {
+		writeErrorMessage(w, 400, reasonBadRequest, "invalid context: "+ctx)
+		return
+	}
+	imp, err := s.impersonationFor(r, ctx)
+	if err != nil {
+		writeErrorMessage(w, 400, reasonBadRequest, "invalid impersonation: "+err.Error())
+		return
+	}
+	rr, err := s.getRegistry(cfg, ctx)
+	if err != nil {
+		writeError(w, 500, reasonRegistryError, err)
+		return
+	}
+	c, err := s.getConn(cfg, ctx, imp)
+	if err != nil {
+		writeError(w, 500, reasonConnectionError, err)
+		return
+	}
+
+	q := r.URL.Query()
+	opts := ExportOptions{
+		Namespace:      q.Get(namespaceQueryParam),
+		IncludeSecrets: q.Get(exportSecretsQueryParam) == exportSecretsInclude,
+	}
+	lg := requestLogger(r.Context())
+	if opts.IncludeSecrets {
+		lg.Info("audit: export with secrets", "namespace", opts.Namespace, "as", imp.User, "remote", r.RemoteAddr)
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	name := snapshot.Name(ctx, opts.Namespace, time.Now()) + ".tar.gz"
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	sw := snapshot.NewTarWriter(w, true)
+	// errors can no longer be reported with a status code, they are recorded in the
+	// snapshot metadata instead and the archive is still completed
+	if err := s.export(r.Context(), cfg, ctx, rr, c, opts, sw); err != nil {
+		lg.Error("export", "error", err)
+		sw.AddError(fmt.Sprintf("export incomplete: %v", err))
+	}
+	if err := sw.Close(); err != nil {
+		lg.Error("export", "error", err)
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gotwarlost/kui/pkg/snapshot"
+	"github.com/stretchr/testify/require"
+)
+
+// exportReplay exports the supplied URL from the replay fixtures and opens the
+// resulting tarball as a snapshot.
+func exportReplay(t *testing.T, r *http.Request) *snapshot.Snapshot {
+	h := newReplayHandler(t)
+	defer h.Close()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	require.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+
+	dir, err := ioutil.TempDir("", "kui-export")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "export.tar.gz")
+	require.Nil(t, ioutil.WriteFile(file, w.Body.Bytes(), 0600))
+	s, err := snapshot.Open(file)
+	require.Nil(t, err)
+	return s
+}
+
+// snapshotGet returns the response body for the supplied API path of the dev context.
+func snapshotGet(t *testing.T, s *snapshot.Snapshot, p string) []byte {
+	r, err := http.NewRequest(http.MethodGet, "http://snapshot.invalid"+p, nil)
+	require.Nil(t, err)
+	res, err := s.Transport("dev").RoundTrip(r)
+	require.Nil(t, err)
+	defer res.Body.Close()
+	require.Equal(t, 200, res.StatusCode)
+	b, err := ioutil.ReadAll(res.Body)
+	require.Nil(t, err)
+	return b
+}
+
+func TestExport(t *testing.T) {
+	s := exportReplay(t, replayRequest("/api/contexts/dev/export?namespace=default"))
+	meta := s.Metadata()
+	require.True(t, meta.Redacted)
+	require.Equal(t, 1, len(meta.Contexts))
+	require.Equal(t, "dev", meta.Contexts[0].Name)
+	require.Equal(t, "default", meta.Contexts[0].Namespace)
+
+	// lists without fixtures could not be read and are recorded as errors
+	var failed []string
+	for _, e := range meta.Errors {
+		failed = append(failed, e[:strings.Index(e, ":")])
+	}
+	sort.Strings(failed)
+	require.Equal(t, []string{
+		"/api/v1/namespaces/default/events",
+		"/api/v1/namespaces/default/replicationcontrollers",
+		"/api/v1/namespaces/default/services",
+		"/apis/apps/v1/namespaces/default/daemonsets",
+		"/apis/apps/v1/namespaces/default/replicasets",
+	}, failed)
+
+	var secrets struct {
+		Items []struct {
+			Data map[string]string `json:"data"`
+		} `json:"items"`
+	}
+	require.Nil(t, json.Unmarshal(snapshotGet(t, s, "/api/v1/namespaces/default/secrets"), &secrets))
+	require.Equal(t, 1, len(secrets.Items))
+	require.Equal(t, map[string]string{"password": redactedValue, "username": redactedValue}, secrets.Items[0].Data)
+
+	var pods struct {
+		Items []json.RawMessage `json:"items"`
+	}
+	require.Nil(t, json.Unmarshal(snapshotGet(t, s, "/api/v1/namespaces/default/pods"), &pods))
+	require.NotEmpty(t, pods.Items)
+	require.Contains(t, string(snapshotGet(t, s, "/api/v1/namespaces")), `"name":"default"`)
+}
+
+func TestExportWithSecrets(t *testing.T) {
+	s := exportReplay(t, replayRequest("/api/contexts/dev/export?namespace=default&secrets=include"))
+	require.False(t, s.Metadata().Redacted)
+	var secrets struct {
+		Items []struct {
+			Data map[string]string `json:"data"`
+		} `json:"items"`
+	}
+	require.Nil(t, json.Unmarshal(snapshotGet(t, s, "/api/v1/namespaces/default/secrets"), &secrets))
+	require.Equal(t, 1, len(secrets.Items))
+	require.Equal(t, map[string]string{"password": "aHVudGVyMg==", "username": "YXBw"}, secrets.Items[0].Data)
+}
+
+func TestExportIncomplete(t *testing.T) {
+	reqCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s := exportReplay(t, replayRequest("/api/contexts/dev/export?namespace=default").WithContext(reqCtx))
+	require.Equal(t, []string{"export incomplete: context canceled"}, s.Metadata().Errors)
+}
@@ -0,0 +1,286 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+	formatTSV  = "tsv"
+	formatYAML = "yaml"
+)
+
+var formatContentTypes = map[string]string{
+	formatJSON: "application/json",
+	formatCSV:  "text/csv; charset=utf-8",
+	formatTSV:  "text/tab-separated-values; charset=utf-8",
+	formatYAML: "application/yaml",
+}
+
+var mediaTypeFormats = map[string]string{
+	"application/json":          formatJSON,
+	"text/csv":                  formatCSV,
+	"text/tab-separated-values": formatTSV,
+	"application/yaml":          formatYAML,
+	"application/x-yaml":        formatYAML,
+	"text/yaml":                 formatYAML,
+}
+
+// negotiateFormat returns the output format from the format query parameter or,
+// if not set, from the first recognized media type in the Accept header. It defaults
+// to JSON.
+func negotiateFormat(r *http.Request) (string, error) {
+	if f := r.Form.Get(formatQueryParam); f != "" {
+		if _, ok := formatContentTypes[f]; !ok {
+			return "", fmt.Errorf("unsupported format %q", f)
+		}
+		return f, nil
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if f, ok := mediaTypeFormats[mt]; ok {
+			return f, nil
+		}
+	}
+	return formatJSON, nil
+}
+
+// checkFormat returns an error if the format is not supported for a single object
+// or a list, as the case may be.
+func checkFormat(format string, object bool) error {
+	switch format {
+	case formatCSV, formatTSV:
+		if object {
+			return fmt.Errorf("format %s is only supported for lists", format)
+		}
+	case formatYAML:
+		if !object {
+			return fmt.Errorf("format %s is only supported for single objects", format)
+		}
+	}
+	return nil
+}
+
+// writeYAML converts the JSON object in the reader to YAML after removing managed fields.
+func writeYAML(r io.Reader, w io.Writer) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return err
+	}
+	if md, ok := obj["metadata"].(map[string]interface{}); ok {
+		delete(md, "managedFields")
+	}
+	out, err := yaml.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// tableRow is a single flattened row of a table along with the order in which
+// columns were seen.
+type tableRow struct {
+	columns []string
+	values  map[string]string
+}
+
+func (t *tableRow) set(column, value string) {
+	if _, ok := t.values[column]; !ok {
+		t.columns = append(t.columns, column)
+	}
+	t.values[column] = value
+}
+
+// flattenValue reads the next JSON value from the decoder and adds it to the row, using
+// dotted column names for nested objects. Arrays of scalars are joined with commas, other
+// arrays are emitted as JSON. Labels are emitted as a single column of k=v pairs.
+func flattenValue(dec *json.Decoder, column string, row *tableRow) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '[' {
+			var items []interface{}
+			scalars := true
+			for dec.More() {
+				var v interface{}
+				if err := dec.Decode(&v); err != nil {
+					return err
+				}
+				switch v.(type) {
+				case map[string]interface{}, []interface{}:
+					scalars = false
+				}
+				items = append(items, v)
+			}
+			if _, err := dec.Token(); err != nil {
+				return err
+			}
+			if scalars {
+				var parts []string
+				for _, item := range items {
+					parts = append(parts, fmt.Sprint(item))
+				}
+				row.set(column, strings.Join(parts, ","))
+				return nil
+			}
+			b, err := json.Marshal(items)
+			if err != nil {
+				return err
+			}
+			row.set(column, string(b))
+			return nil
+		}
+		labels := column == "metadata.labels"
+		var pairs []string
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key := fmt.Sprint(keyTok)
+			if labels {
+				var v interface{}
+				if err := dec.Decode(&v); err != nil {
+					return err
+				}
+				pairs = append(pairs, fmt.Sprintf("%s=%v", key, v))
+				continue
+			}
+			name := key
+			if column != "" {
+				name = column + "." + key
+			}
+			if err := flattenValue(dec, name, row); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		if labels {
+			row.set(column, strings.Join(pairs, ","))
+		}
+	case nil:
+		row.set(column, "")
+	default:
+		row.set(column, fmt.Sprint(t))
+	}
+	return nil
+}
+
+// flattenRow returns a flattened row for the supplied projected JSON object.
+func flattenRow(b []byte) (*tableRow, error) {
+	row := &tableRow{values: map[string]string{}}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := flattenValue(dec, "", row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// tableWriter writes the records of a table.
+type tableWriter interface {
+	Write(record []string) error
+	Flush()
+	Error() error
+}
+
+// tsvEscaper escapes the characters that cannot appear in a TSV value.
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// tsvWriter writes tab-separated values. TSV has no quoting, so tabs, newlines and
+// backslashes in values are escaped instead.
+type tsvWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (t *tsvWriter) Write(record []string) error {
+	if t.err != nil {
+		return t.err
+	}
+	for i, v := range record {
+		if i > 0 {
+			t.w.WriteByte('\t')
+		}
+		t.w.WriteString(tsvEscaper.Replace(v))
+	}
+	_, t.err = t.w.WriteString("\n")
+	return t.err
+}
+
+func (t *tsvWriter) Flush() {
+	if t.err == nil {
+		t.err = t.w.Flush()
+	}
+}
+
+func (t *tsvWriter) Error() error {
+	return t.err
+}
+
+// processTable writes projected list items as CSV or TSV. Columns are the union of
+// flattened projected fields in the order they were first seen.
+func (df *dataFilter) processTable(format string) error {
+	if err := df.skipToItems(); err != nil {
+		return err
+	}
+	var columns []string
+	seen := map[string]bool{}
+	var rows []*tableRow
+	err := df.eachItem(func(_ []byte, row *tableRow) error {
+		for _, c := range row.columns {
+			if !seen[c] {
+				seen[c] = true
+				columns = append(columns, c)
+			}
+		}
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	var tw tableWriter = csv.NewWriter(df.w)
+	if format == formatTSV {
+		tw = &tsvWriter{w: bufio.NewWriter(df.w)}
+	}
+	if err := tw.Write(columns); err != nil {
+		return err
+	}
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, c := range columns {
+			record[i] = row.values[c]
+		}
+		if err := tw.Write(record); err != nil {
+			return err
+		}
+	}
+	tw.Flush()
+	return tw.Error()
+}
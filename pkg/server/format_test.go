@@ -0,0 +1,86 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?format=tsv", nil)
+	r.ParseForm()
+	f, err := negotiateFormat(r)
+	require.Nil(t, err)
+	require.Equal(t, formatTSV, f)
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "text/html, text/csv;q=0.9")
+	r.ParseForm()
+	f, err = negotiateFormat(r)
+	require.Nil(t, err)
+	require.Equal(t, formatCSV, f)
+
+	r = httptest.NewRequest("GET", "/?format=xml", nil)
+	r.ParseForm()
+	_, err = negotiateFormat(r)
+	require.NotNil(t, err)
+
+	require.NotNil(t, checkFormat(formatCSV, true))
+	require.NotNil(t, checkFormat(formatYAML, false))
+	require.Nil(t, checkFormat(formatJSON, true))
+}
+
+func TestCSVProjection(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/pod-list.json")
+	require.Nil(t, err)
+
+	var w bytes.Buffer
+	df := newFilter(bytes.NewReader(b), &w, "/:Pod")
+	err = df.processTable(formatCSV)
+	require.Nil(t, err)
+
+	records, err := csv.NewReader(&w).ReadAll()
+	require.Nil(t, err)
+	require.Equal(t, 4, len(records))
+	header := records[0]
+	col := func(name string) int {
+		for i, h := range header {
+			if h == name {
+				return i
+			}
+		}
+		t.Fatalf("column %s not found in %v", name, header)
+		return -1
+	}
+	require.Equal(t, "test-identity-client-84d67bb5c7-55z9q", records[1][col("metadata.name")])
+	require.Equal(t, "app=test-identity-client,pod-template-hash=4082366173", records[1][col("metadata.labels")])
+	require.Equal(t, "Guaranteed", records[1][col("derived.qosClass")])
+	require.Equal(t, "0", records[1][col("derived.restarts")])
+}
+
+func TestTSVWriter(t *testing.T) {
+	var w bytes.Buffer
+	tw := &tsvWriter{w: bufio.NewWriter(&w)}
+	require.Nil(t, tw.Write([]string{"a", `say "hi"`}))
+	require.Nil(t, tw.Write([]string{"tab\there", "two\nlines", `back\slash`}))
+	tw.Flush()
+	require.Nil(t, tw.Error())
+	require.Equal(t, "a\tsay \"hi\"\ntab\\there\ttwo\\nlines\tback\\\\slash\n", w.String())
+}
+
+func TestWriteYAML(t *testing.T) {
+	in := `{"kind":"ConfigMap","metadata":{"name":"foo","managedFields":[{"manager":"kubectl"}]},"data":{"a":"b"}}`
+	var w bytes.Buffer
+	err := writeYAML(strings.NewReader(in), &w)
+	require.Nil(t, err)
+	out := w.String()
+	require.Contains(t, out, "name: foo")
+	require.Contains(t, out, "a: b")
+	require.NotContains(t, out, "managedFields")
+}
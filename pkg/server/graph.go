@@ -0,0 +1,509 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/dimfeld/httptreemux"
+	"github.com/gotwarlost/kui/pkg/registry"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// relations between objects in a graph.
+const (
+	relationOwns            = "owns"            // owner reference
+	relationSelects         = "selects"         // label selector match
+	relationVolume          = "volume"          // volume or projected volume source
+	relationEnv             = "env"             // env value from a key
+	relationEnvFrom         = "envFrom"         // all keys as env
+	relationImagePullSecret = "imagePullSecret" // image pull secret
+	relationServiceAccount  = "serviceAccount"  // service account
+)
+
+// graphKinds are the namespaced kinds that are loaded to compute relationships.
+var graphKinds = []registry.ResourceKey{
+	{ResourceVersion: "/", Kind: "Pod"},
+	{ResourceVersion: "apps/", Kind: "ReplicaSet"},
+	{ResourceVersion: "apps/", Kind: "Deployment"},
+	{ResourceVersion: "apps/", Kind: "StatefulSet"},
+	{ResourceVersion: "apps/", Kind: "DaemonSet"},
+	{ResourceVersion: "batch/", Kind: "Job"},
+	{ResourceVersion: "batch/", Kind: "CronJob"},
+	{ResourceVersion: "/", Kind: "Service"},
+}
+
+// refKinds are the resource keys of kinds referenced from pod specs.
+var refKinds = map[string]string{
+	"ConfigMap":             "v1:ConfigMap",
+	"Secret":                "v1:Secret",
+	"PersistentVolumeClaim": "v1:PersistentVolumeClaim",
+	"ServiceAccount":        "v1:ServiceAccount",
+}
+
+// GraphNode is a single object in a relationship graph.
+type GraphNode struct {
+	ID        string `json:"id"`        // unique ID in the graph, of the form kind/name
+	Resource  string `json:"resource"`  // the resource key of the object
+	Kind      string `json:"kind"`      // the object kind
+	Namespace string `json:"namespace"` // the object namespace
+	Name      string `json:"name"`      // the object name
+}
+
+// GraphEdge is a relationship between two objects.
+type GraphEdge struct {
+	From     string `json:"from"`     // the ID of the owning, selecting or referencing object
+	To       string `json:"to"`       // the ID of the owned, selected or referenced object
+	Relation string `json:"relation"` // the type of relationship
+}
+
+// Graph is the relationship graph of an object.
+type Graph struct {
+	Root   string      `json:"root"`             // ID of the object for which the graph was computed
+	Nodes  []GraphNode `json:"nodes"`            // all objects in the graph
+	Edges  []GraphEdge `json:"edges"`            // relationships between the objects
+	Errors []string    `json:"errors,omitempty"` // load errors for related kinds or objects, if any
+}
+
+// graphObject is the subset of an object needed to compute relationships.
+type graphObject struct {
+	resource string
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name            string                  `json:"name"`
+		Namespace       string                  `json:"namespace"`
+		UID             string                  `json:"uid"`
+		Labels          map[string]string       `json:"labels"`
+		OwnerReferences []metav1.OwnerReference `json:"ownerReferences"`
+	} `json:"metadata"`
+	Spec json.RawMessage `json:"spec"`
+}
+
+func graphID(kind, name string) string {
+	return kind + "/" + name
+}
+
+func (o *graphObject) id() string {
+	return graphID(o.Kind, o.Metadata.Name)
+}
+
+// podSpec returns the pod spec of a pod or the pod template spec of a workload,
+// or nil if the object has neither.
+func (o *graphObject) podSpec() (*v1.PodSpec, error) {
+	if len(o.Spec) == 0 {
+		return nil, nil
+	}
+	switch o.Kind {
+	case "Pod":
+		var spec v1.PodSpec
+		if err := json.Unmarshal(o.Spec, &spec); err != nil {
+			return nil, err
+		}
+		return &spec, nil
+	case "CronJob":
+		var spec struct {
+			JobTemplate struct {
+				Spec struct {
+					Template v1.PodTemplateSpec `json:"template"`
+				} `json:"spec"`
+			} `json:"jobTemplate"`
+		}
+		if err := json.Unmarshal(o.Spec, &spec); err != nil {
+			return nil, err
+		}
+		return &spec.JobTemplate.Spec.Template.Spec, nil
+	case "Deployment", "ReplicaSet", "StatefulSet", "DaemonSet", "Job", "ReplicationController":
+		var spec struct {
+			Template *v1.PodTemplateSpec `json:"template"`
+		}
+		if err := json.Unmarshal(o.Spec, &spec); err != nil {
+			return nil, err
+		}
+		if spec.Template == nil {
+			return nil, nil
+		}
+		return &spec.Template.Spec, nil
+	}
+	return nil, nil
+}
+
+// selector returns the label selector of the object and the kind it selects or
+// a nil selector if the object does not select anything.
+func (o *graphObject) selector() (labels.Selector, string, error) {
+	if len(o.Spec) == 0 {
+		return nil, "", nil
+	}
+	switch o.Kind {
+	case "Service":
+		var spec struct {
+			Selector map[string]string `json:"selector"`
+		}
+		if err := json.Unmarshal(o.Spec, &spec); err != nil {
+			return nil, "", err
+		}
+		if len(spec.Selector) == 0 {
+			return nil, "", nil
+		}
+		return labels.SelectorFromSet(spec.Selector), "Pod", nil
+	case "Deployment", "ReplicaSet", "StatefulSet", "DaemonSet", "Job":
+		var spec struct {
+			Selector *metav1.LabelSelector `json:"selector"`
+		}
+		if err := json.Unmarshal(o.Spec, &spec); err != nil {
+			return nil, "", err
+		}
+		if spec.Selector == nil {
+			return nil, "", nil
+		}
+		sel, err := metav1.LabelSelectorAsSelector(spec.Selector)
+		if err != nil {
+			return nil, "", err
+		}
+		target := "Pod"
+		if o.Kind == "Deployment" {
+			target = "ReplicaSet"
+		}
+		return sel, target, nil
+	}
+	return nil, "", nil
+}
+
+// podRef is a reference from a pod spec to another object.
+type podRef struct {
+	kind     string
+	name     string
+	relation string
+}
+
+// podRefs returns the config maps, secrets, volume claims and service accounts
+// referenced by the supplied pod spec.
+func podRefs(spec *v1.PodSpec) []podRef {
+	var ret []podRef
+	seen := map[podRef]bool{}
+	add := func(kind, name, relation string) {
+		r := podRef{kind: kind, name: name, relation: relation}
+		if name == "" || seen[r] {
+			return
+		}
+		seen[r] = true
+		ret = append(ret, r)
+	}
+	for _, v := range spec.Volumes {
+		switch {
+		case v.ConfigMap != nil:
+			add("ConfigMap", v.ConfigMap.Name, relationVolume)
+		case v.Secret != nil:
+			add("Secret", v.Secret.SecretName, relationVolume)
+		case v.PersistentVolumeClaim != nil:
+			add("PersistentVolumeClaim", v.PersistentVolumeClaim.ClaimName, relationVolume)
+		case v.Projected != nil:
+			for _, src := range v.Projected.Sources {
+				if src.ConfigMap != nil {
+					add("ConfigMap", src.ConfigMap.Name, relationVolume)
+				}
+				if src.Secret != nil {
+					add("Secret", src.Secret.Name, relationVolume)
+				}
+			}
+		}
+	}
+	containers := append(append([]v1.Container(nil), spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		for _, e := range c.EnvFrom {
+			if e.ConfigMapRef != nil {
+				add("ConfigMap", e.ConfigMapRef.Name, relationEnvFrom)
+			}
+			if e.SecretRef != nil {
+				add("Secret", e.SecretRef.Name, relationEnvFrom)
+			}
+		}
+		for _, e := range c.Env {
+			if e.ValueFrom == nil {
+				continue
+			}
+			if e.ValueFrom.ConfigMapKeyRef != nil {
+				add("ConfigMap", e.ValueFrom.ConfigMapKeyRef.Name, relationEnv)
+			}
+			if e.ValueFrom.SecretKeyRef != nil {
+				add("Secret", e.ValueFrom.SecretKeyRef.Name, relationEnv)
+			}
+		}
+	}
+	for _, s := range spec.ImagePullSecrets {
+		add("Secret", s.Name, relationImagePullSecret)
+	}
+	add("ServiceAccount", spec.ServiceAccountName, relationServiceAccount)
+	return ret
+}
+
+// buildGraph computes the relationship graph for the root object from the supplied objects
+// in its namespace. The graph has the owners of the root, objects selecting it, objects
+// it owns or selects (transitively, including those of its owners) and the objects
+// referenced by all included pods and workloads. If the root is itself referenced by pod
+// specs, the referencing objects are also included. Objects with a selector or pod spec
+// that cannot be parsed are recorded in the errors of the graph.
+func buildGraph(root *graphObject, objects []*graphObject) *Graph {
+	nodes := map[string]GraphNode{}
+	newNode := func(resource, kind, name string) GraphNode {
+		return GraphNode{ID: graphID(kind, name), Resource: resource, Kind: kind, Namespace: root.Metadata.Namespace, Name: name}
+	}
+
+	byID := map[string]*graphObject{}
+	byUID := map[string]*graphObject{}
+	for _, o := range append([]*graphObject{root}, objects...) {
+		if _, ok := byID[o.id()]; ok {
+			continue
+		}
+		byID[o.id()] = o
+		if o.Metadata.UID != "" {
+			byUID[o.Metadata.UID] = o
+		}
+	}
+
+	// objects with a selector or spec that cannot be parsed are recorded as errors
+	// and their edges are skipped
+	var errs []string
+	addError := func(o *graphObject, err error) {
+		errs = append(errs, fmt.Sprintf("%s: %v", o.id(), err))
+	}
+
+	// structural edges: ownership and selection
+	var structural []GraphEdge
+	seen := map[[2]string]bool{}
+	out := map[string][]string{}
+	in := map[string][]GraphEdge{}
+	unloaded := map[string]GraphNode{} // owners that were not loaded
+	addStructural := func(from, to, relation string) {
+		k := [2]string{from, to}
+		if seen[k] {
+			return
+		}
+		seen[k] = true
+		e := GraphEdge{From: from, To: to, Relation: relation}
+		structural = append(structural, e)
+		out[from] = append(out[from], to)
+		in[to] = append(in[to], e)
+	}
+	for _, o := range byID {
+		for _, ref := range o.Metadata.OwnerReferences {
+			owner, ok := byUID[string(ref.UID)]
+			if !ok {
+				n := newNode(ref.APIVersion+":"+ref.Kind, ref.Kind, ref.Name)
+				unloaded[n.ID] = n
+				addStructural(n.ID, o.id(), relationOwns)
+				continue
+			}
+			addStructural(owner.id(), o.id(), relationOwns)
+		}
+	}
+	for _, o := range byID {
+		sel, target, err := o.selector()
+		if err != nil {
+			addError(o, err)
+			continue
+		}
+		if sel == nil {
+			continue
+		}
+		for _, candidate := range byID {
+			if candidate.Kind == target && sel.Matches(labels.Set(candidate.Metadata.Labels)) {
+				addStructural(o.id(), candidate.id(), relationSelects)
+			}
+		}
+	}
+
+	// owners of the root, transitively
+	included := map[string]bool{root.id(): true}
+	ancestors := []string{root.id()}
+	for i := 0; i < len(ancestors); i++ {
+		for _, e := range in[ancestors[i]] {
+			if e.Relation == relationOwns && !included[e.From] {
+				included[e.From] = true
+				ancestors = append(ancestors, e.From)
+			}
+		}
+	}
+	// objects selecting the root
+	for _, e := range in[root.id()] {
+		included[e.From] = true
+	}
+	// objects owned or selected by the root and its owners, transitively
+	visited := map[string]bool{}
+	queue := ancestors
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		for _, to := range out[id] {
+			included[to] = true
+			queue = append(queue, to)
+		}
+	}
+
+	g := &Graph{Root: root.id()}
+	for _, e := range structural {
+		if included[e.From] && included[e.To] {
+			g.Edges = append(g.Edges, e)
+		}
+	}
+
+	// references from pod specs
+	var refNodes []GraphNode
+	for _, o := range byID {
+		spec, err := o.podSpec()
+		if err != nil {
+			addError(o, err)
+			continue
+		}
+		if spec == nil {
+			continue
+		}
+		isIncluded := included[o.id()]
+		for _, ref := range podRefs(spec) {
+			to := graphID(ref.kind, ref.name)
+			if !isIncluded && to != root.id() {
+				continue
+			}
+			included[o.id()] = true
+			refNodes = append(refNodes, newNode(refKinds[ref.kind], ref.kind, ref.name))
+			g.Edges = append(g.Edges, GraphEdge{From: o.id(), To: to, Relation: ref.relation})
+		}
+	}
+
+	for id := range included {
+		if o, ok := byID[id]; ok {
+			nodes[id] = newNode(o.resource, o.Kind, o.Metadata.Name)
+		} else if n, ok := unloaded[id]; ok {
+			nodes[id] = n
+		}
+	}
+	for _, n := range refNodes {
+		if _, ok := nodes[n.ID]; !ok {
+			nodes[n.ID] = n
+		}
+	}
+
+	for _, n := range nodes {
+		g.Nodes = append(g.Nodes, n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].ID < g.Nodes[j].ID
+	})
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Relation < b.Relation
+	})
+	sort.Strings(errs)
+	g.Errors = errs
+	return g
+}
+
+// loadGraphObjects lists all objects of the graph kinds in the supplied namespace. Kinds
+// that are not available or cannot be listed are recorded as errors.
+func loadGraphObjects(reqCtx context.Context, c *conn, rr *registry.ResourceRegistry, namespace string) ([]*graphObject, []string) {
+	var (
+		l       sync.Mutex
+		wg      sync.WaitGroup
+		objects []*graphObject
+		errs    []string
+	)
+	for _, key := range graphKinds {
+		ri, err := rr.ResourceInfo(key)
+		if err != nil {
+			continue // kind not supported by the cluster
+		}
+		wg.Add(1)
+		go func(ri *registry.ResourceInfo) {
+			defer wg.Done()
+			var list struct {
+				Items []*graphObject `json:"items"`
+			}
+			err := c.getJSON(reqCtx, ri.APIListPath(namespace), &list)
+			l.Lock()
+			defer l.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("list %s: %v", ri.PluralName, err))
+				return
+			}
+			for _, o := range list.Items {
+				o.Kind = ri.Key.Kind
+				o.resource = ri.Key.String()
+				objects = append(objects, o)
+			}
+		}(ri)
+	}
+	wg.Wait()
+	sort.Strings(errs)
+	return objects, errs
+}
+
+// getGraph returns the relationship graph for a single namespaced object.
+func (s *server) getGraph(w http.ResponseWriter, r *http.Request) {
+	p := httptreemux.ContextParams(r.Context())
+	cfg, err := s.getConfig()
+	if err != nil {
+		writeError(w, 500, reasonConfigError, err)
+		return
+	}
+
+	r.ParseForm()
+
+	ctx := p[contextParamName]
+	id := p[resourceIDParamName]
+	ns := r.Form.Get(namespaceQueryParam)
+
+	ri, err := s.getResourceInfo(cfg, ctx, r.Form.Get(resourceQueryParam))
+	if err != nil {
+		writeResourceInfoError(w, err)
+		return
+	}
+	if ri.IsClusterResource || ns == "" {
+		writeErrorMessage(w, 400, reasonBadRequest, "graphs are only supported for namespaced objects, with a namespace")
+		return
+	}
+	rr, err := s.getRegistry(cfg, ctx)
+	if err != nil {
+		writeError(w, 500, reasonRegistryError, err)
+		return
+	}
+	imp, err := s.impersonationFor(r, ctx)
+	if err != nil {
+		writeErrorMessage(w, 400, reasonBadRequest, "invalid impersonation: "+err.Error())
+		return
+	}
+	conn, err := s.getConn(cfg, ctx, imp)
+	if err != nil {
+		writeError(w, 500, reasonConnectionError, err)
+		return
+	}
+
+	var root graphObject
+	if err := conn.getJSON(r.Context(), ri.APIListPath(ns)+"/"+id, &root); err != nil {
+		writeDownstreamError(w, err)
+		return
+	}
+	root.Kind = ri.Key.Kind
+	root.resource = ri.Key.String()
+
+	objects, errs := loadGraphObjects(r.Context(), conn, rr, ns)
+	g := buildGraph(&root, objects)
+	g.Errors = append(errs, g.Errors...)
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.Encode(g)
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gotwarlost/kui/pkg/registry"
+	"github.com/stretchr/testify/require"
+)
+
+func mustGraphObject(t *testing.T, kind string, s string) *graphObject {
+	var o graphObject
+	require.Nil(t, json.Unmarshal([]byte(s), &o))
+	o.Kind = kind
+	o.resource = "test:" + kind
+	return &o
+}
+
+func graphFixtures(t *testing.T) []*graphObject {
+	return []*graphObject{
+		mustGraphObject(t, "Deployment", `{"metadata":{"name":"web","namespace":"ns","uid":"d1","labels":{"app":"web"}},
+"spec":{"selector":{"matchLabels":{"app":"web"}},"template":{"spec":{"containers":[{"name":"main",
+"envFrom":[{"configMapRef":{"name":"web-config"}}]}]}}}}`),
+		mustGraphObject(t, "ReplicaSet", `{"metadata":{"name":"web-1","namespace":"ns","uid":"r1","labels":{"app":"web"},
+"ownerReferences":[{"apiVersion":"apps/v1","kind":"Deployment","name":"web","uid":"d1","controller":true}]},
+"spec":{"selector":{"matchLabels":{"app":"web"}}}}`),
+		mustGraphObject(t, "Pod", `{"metadata":{"name":"web-1-a","namespace":"ns","uid":"p1","labels":{"app":"web"},
+"ownerReferences":[{"apiVersion":"apps/v1","kind":"ReplicaSet","name":"web-1","uid":"r1","controller":true}]},
+"spec":{"serviceAccountName":"web","volumes":[{"name":"tls","secret":{"secretName":"web-tls"}}],
+"containers":[{"name":"main","envFrom":[{"configMapRef":{"name":"web-config"}}]}]}}`),
+		mustGraphObject(t, "Service", `{"metadata":{"name":"web","namespace":"ns","uid":"s1"},"spec":{"selector":{"app":"web"}}}`),
+		mustGraphObject(t, "Pod", `{"metadata":{"name":"other","namespace":"ns","uid":"p2","labels":{"app":"other"}},
+"spec":{"containers":[{"name":"main","env":[{"name":"X","valueFrom":{"secretKeyRef":{"name":"web-tls","key":"k"}}}]}]}}`),
+	}
+}
+
+func edgeSet(g *Graph) map[GraphEdge]bool {
+	ret := map[GraphEdge]bool{}
+	for _, e := range g.Edges {
+		ret[e] = true
+	}
+	return ret
+}
+
+func nodeIDs(g *Graph) []string {
+	var ret []string
+	for _, n := range g.Nodes {
+		ret = append(ret, n.ID)
+	}
+	return ret
+}
+
+func TestGraphFromPod(t *testing.T) {
+	objects := graphFixtures(t)
+	g := buildGraph(objects[2], objects)
+	require.Equal(t, "Pod/web-1-a", g.Root)
+	require.Equal(t, []string{
+		"ConfigMap/web-config",
+		"Deployment/web",
+		"Pod/web-1-a",
+		"ReplicaSet/web-1",
+		"Secret/web-tls",
+		"Service/web",
+		"ServiceAccount/web",
+	}, nodeIDs(g))
+	edges := edgeSet(g)
+	require.True(t, edges[GraphEdge{From: "Deployment/web", To: "ReplicaSet/web-1", Relation: relationOwns}])
+	require.True(t, edges[GraphEdge{From: "ReplicaSet/web-1", To: "Pod/web-1-a", Relation: relationOwns}])
+	require.True(t, edges[GraphEdge{From: "Service/web", To: "Pod/web-1-a", Relation: relationSelects}])
+	require.True(t, edges[GraphEdge{From: "Pod/web-1-a", To: "Secret/web-tls", Relation: relationVolume}])
+	require.True(t, edges[GraphEdge{From: "Deployment/web", To: "ConfigMap/web-config", Relation: relationEnvFrom}])
+	require.True(t, edges[GraphEdge{From: "Pod/web-1-a", To: "ServiceAccount/web", Relation: relationServiceAccount}])
+}
+
+func TestGraphFromReferencedSecret(t *testing.T) {
+	objects := graphFixtures(t)
+	root := mustGraphObject(t, "Secret", `{"metadata":{"name":"web-tls","namespace":"ns"}}`)
+	g := buildGraph(root, objects)
+	require.Equal(t, []string{"Pod/other", "Pod/web-1-a", "Secret/web-tls"}, nodeIDs(g))
+}
+
+func TestGraphUnloadedOwner(t *testing.T) {
+	root := mustGraphObject(t, "Pod", `{"metadata":{"name":"job-a","namespace":"ns","uid":"p1",
+"ownerReferences":[{"apiVersion":"example.com/v1","kind":"Workflow","name":"wf","uid":"w1"}]}}`)
+	g := buildGraph(root, nil)
+	require.Equal(t, []string{"Pod/job-a", "Workflow/wf"}, nodeIDs(g))
+	require.Equal(t, "example.com/v1:Workflow", g.Nodes[1].Resource)
+}
+
+func TestGraphInvalidObject(t *testing.T) {
+	objects := graphFixtures(t)
+	bad := mustGraphObject(t, "Deployment", `{"metadata":{"name":"bad","namespace":"ns"},
+"spec":{"selector":{"matchExpressions":[{"key":"app","operator":"Nope"}]}}}`)
+	g := buildGraph(objects[2], append(objects, bad))
+	require.Equal(t, "Pod/web-1-a", g.Root)
+	require.Equal(t, 1, len(g.Errors))
+	require.Contains(t, g.Errors[0], "Deployment/bad")
+	require.Contains(t, nodeIDs(g), "Service/web")
+}
+
+func TestFindUsages(t *testing.T) {
+	objects := graphFixtures(t)
+	usages, err := findUsages("ConfigMap", "web-config", objects)
+	require.Nil(t, err)
+	require.Equal(t, []Usage{
+		{Resource: "test:Deployment", Kind: "Deployment", Namespace: "ns", Name: "web", References: []string{relationEnvFrom}},
+		{Resource: "test:Pod", Kind: "Pod", Namespace: "ns", Name: "web-1-a", References: []string{relationEnvFrom}},
+	}, usages)
+
+	usages, err = findUsages("Secret", "web-tls", objects)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(usages))
+	require.Equal(t, []string{relationEnv}, usages[0].References)
+	require.Equal(t, []string{relationVolume}, usages[1].References)
+
+	usages, err = findUsages("ServiceAccount", "default", objects)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(usages)) // deployment template and other pod do not set an account
+
+	usages, err = findUsages("Secret", "nope", objects)
+	require.Nil(t, err)
+	require.Equal(t, []Usage{}, usages)
+}
+
+func TestUsageKinds(t *testing.T) {
+	key := func(s string) string {
+		k, err := registry.ResourceKeyFromString(s)
+		require.Nil(t, err)
+		return k.WithEmptyVersion().String()
+	}
+	require.True(t, usageKinds[key("v1:Secret")])
+	require.False(t, usageKinds[key("example.com/v1:Secret")])
+}
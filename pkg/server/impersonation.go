@@ -0,0 +1,144 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// request headers and query parameters that set the impersonation for a single request.
+const (
+	impersonateUserHeader   = "X-Kui-Impersonate-User"
+	impersonateUIDHeader    = "X-Kui-Impersonate-Uid"
+	impersonateGroupHeader  = "X-Kui-Impersonate-Group"
+	impersonateExtraPrefix  = "X-Kui-Impersonate-Extra-"
+	impersonateUserParam    = "as"
+	impersonateUIDParam     = "as-uid"
+	impersonateGroupParam   = "as-group"
+	impersonateExtraParam   = "as-extra"
+	k8sImpersonateUser      = "Impersonate-User"
+	k8sImpersonateUID       = "Impersonate-Uid"
+	k8sImpersonateGroup     = "Impersonate-Group"
+	k8sImpersonateExtraPref = "Impersonate-Extra-"
+)
+
+// isEmpty returns true if no impersonation is requested.
+func (imp Impersonation) isEmpty() bool {
+	return imp.User == "" && imp.UID == "" && len(imp.Groups) == 0 && len(imp.Extra) == 0
+}
+
+// validate returns an error if the impersonation cannot be sent to the Kubernetes API.
+func (imp Impersonation) validate() error {
+	if imp.User == "" && !imp.isEmpty() {
+		return fmt.Errorf("a user is required to impersonate a uid, groups or extra values")
+	}
+	for _, g := range imp.Groups {
+		if g == "" {
+			return fmt.Errorf("empty impersonation group")
+		}
+	}
+	for k := range imp.Extra {
+		if k == "" {
+			return fmt.Errorf("empty impersonation extra key")
+		}
+	}
+	return nil
+}
+
+// setHeaders sets the Kubernetes impersonation headers on the supplied header.
+// Extra keys are escaped in the way that the API server expects.
+func (imp Impersonation) setHeaders(h http.Header) {
+	if imp.User != "" {
+		h.Set(k8sImpersonateUser, imp.User)
+	}
+	if imp.UID != "" {
+		h.Set(k8sImpersonateUID, imp.UID)
+	}
+	for _, g := range imp.Groups {
+		if g != "" {
+			h.Add(k8sImpersonateGroup, g)
+		}
+	}
+	var keys []string
+	for k := range imp.Extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name := k8sImpersonateExtraPref + url.PathEscape(k)
+		for _, v := range imp.Extra[k] {
+			h.Add(name, v)
+		}
+	}
+}
+
+// impersonationFromRequest returns the impersonation set by the request headers or
+// query parameters, with query parameters taking precedence. It returns false if the
+// request does not set a user. An explicitly empty user resets the impersonation
+// such that the request is made with the identity from the kubeconfig.
+func impersonationFromRequest(r *http.Request) (Impersonation, bool, error) {
+	var imp Impersonation
+	q := r.URL.Query()
+	if users, ok := q[impersonateUserParam]; ok {
+		imp.User = users[0]
+		imp.UID = q.Get(impersonateUIDParam)
+		for _, g := range q[impersonateGroupParam] {
+			imp.Groups = append(imp.Groups, strings.Split(g, ",")...)
+		}
+		for _, e := range q[impersonateExtraParam] {
+			parts := strings.SplitN(e, "=", 2)
+			if len(parts) != 2 {
+				return imp, false, fmt.Errorf("invalid %s parameter %q, must be key=value", impersonateExtraParam, e)
+			}
+			imp.addExtra(parts[0], parts[1])
+		}
+	} else if users, ok := r.Header[impersonateUserHeader]; ok {
+		imp.User = users[0]
+		imp.UID = r.Header.Get(impersonateUIDHeader)
+		imp.Groups = r.Header[impersonateGroupHeader]
+		for name, values := range r.Header {
+			if !strings.HasPrefix(name, impersonateExtraPrefix) {
+				continue
+			}
+			for _, v := range values {
+				imp.addExtra(strings.ToLower(name[len(impersonateExtraPrefix):]), v)
+			}
+		}
+	} else {
+		return imp, false, nil
+	}
+	if err := imp.validate(); err != nil {
+		return imp, false, err
+	}
+	return imp, true, nil
+}
+
+// addExtra adds an extra value for the supplied key.
+func (imp *Impersonation) addExtra(k, v string) {
+	if imp.Extra == nil {
+		imp.Extra = map[string][]string{}
+	}
+	imp.Extra[k] = append(imp.Extra[k], v)
+}
+
+// impersonationFor returns the impersonation for a request to the supplied context. The
+// request setting takes precedence over the setting for the context which, in turn,
+// takes precedence over the default.
+func (s *server) impersonationFor(r *http.Request, ctx string) (Impersonation, error) {
+	imp, ok, err := impersonationFromRequest(r)
+	if err != nil || ok {
+		return imp, err
+	}
+	return s.configuredImpersonation(ctx), nil
+}
+
+// configuredImpersonation returns the impersonation configured for the supplied
+// context, or the default.
+func (s *server) configuredImpersonation(ctx string) Impersonation {
+	if imp, ok := s.contextImpersonation[ctx]; ok {
+		return imp
+	}
+	return s.impersonation
+}
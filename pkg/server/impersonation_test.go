@@ -0,0 +1,85 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestImpersonationFromRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/contexts/dev?as=jane&as-uid=42&as-group=dev,ops&as-extra=scopes=view&as-extra=scopes=edit", nil)
+	imp, ok, err := impersonationFromRequest(r)
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Equal(t, Impersonation{
+		User:   "jane",
+		UID:    "42",
+		Groups: []string{"dev", "ops"},
+		Extra:  map[string][]string{"scopes": {"view", "edit"}},
+	}, imp)
+
+	r = httptest.NewRequest("GET", "/api/contexts/dev", nil)
+	r.Header.Set(impersonateUserHeader, "joe")
+	r.Header.Add(impersonateGroupHeader, "tenant-x")
+	r.Header.Add("X-Kui-Impersonate-Extra-Reason", "debugging")
+	imp, ok, err = impersonationFromRequest(r)
+	require.Nil(t, err)
+	require.True(t, ok)
+	require.Equal(t, Impersonation{
+		User:   "joe",
+		Groups: []string{"tenant-x"},
+		Extra:  map[string][]string{"reason": {"debugging"}},
+	}, imp)
+
+	r = httptest.NewRequest("GET", "/api/contexts/dev", nil)
+	_, ok, err = impersonationFromRequest(r)
+	require.Nil(t, err)
+	require.False(t, ok)
+
+	r = httptest.NewRequest("GET", "/api/contexts/dev?as-group=dev&as=", nil)
+	_, _, err = impersonationFromRequest(r)
+	require.NotNil(t, err)
+
+	r = httptest.NewRequest("GET", "/api/contexts/dev?as=jane&as-extra=scopes", nil)
+	_, _, err = impersonationFromRequest(r)
+	require.NotNil(t, err)
+}
+
+func TestImpersonationPrecedence(t *testing.T) {
+	s := &server{
+		impersonation:        Impersonation{User: "default"},
+		contextImpersonation: map[string]Impersonation{"dev": {User: "tenant-x"}},
+	}
+	imp, err := s.impersonationFor(httptest.NewRequest("GET", "/", nil), "prod")
+	require.Nil(t, err)
+	require.Equal(t, "default", imp.User)
+
+	imp, err = s.impersonationFor(httptest.NewRequest("GET", "/", nil), "dev")
+	require.Nil(t, err)
+	require.Equal(t, "tenant-x", imp.User)
+
+	imp, err = s.impersonationFor(httptest.NewRequest("GET", "/?as=jane", nil), "dev")
+	require.Nil(t, err)
+	require.Equal(t, "jane", imp.User)
+
+	imp, err = s.impersonationFor(httptest.NewRequest("GET", "/?as=", nil), "dev")
+	require.Nil(t, err)
+	require.True(t, imp.isEmpty())
+}
+
+func TestImpersonationHeaders(t *testing.T) {
+	imp := Impersonation{
+		User:   "jane",
+		UID:    "42",
+		Groups: []string{"dev", "ops"},
+		Extra:  map[string][]string{"acme.com/project": {"a", "b"}},
+	}
+	h := http.Header{}
+	imp.setHeaders(h)
+	require.Equal(t, "jane", h.Get("Impersonate-User"))
+	require.Equal(t, "42", h.Get("Impersonate-Uid"))
+	require.Equal(t, []string{"dev", "ops"}, h["Impersonate-Group"])
+	require.Equal(t, []string{"a", "b"}, h["Impersonate-Extra-Acme.com%2fproject"])
+}
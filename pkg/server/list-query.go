@@ -0,0 +1,203 @@
+package server
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// itemFilter matches projected items by substring or regular expression. When the
+// field is empty, the name, label values and derived fields are all candidates.
+type itemFilter struct {
+	field  string
+	substr string
+	re     *regexp.Regexp
+}
+
+func (f itemFilter) matchValue(v string) bool {
+	if f.re != nil {
+		return f.re.MatchString(v)
+	}
+	return strings.Contains(v, f.substr)
+}
+
+// sortKey is a single sort field and direction.
+type sortKey struct {
+	field string
+	desc  bool
+}
+
+// listQuery is the set of filters and sort keys to apply to projected list items.
+type listQuery struct {
+	filters []itemFilter
+	sorts   []sortKey
+}
+
+// isScopedField returns true if the supplied string looks like a field name rather than
+// part of a value.
+func isScopedField(s string) bool {
+	if s == "" || strings.ContainsAny(s, " /") {
+		return false
+	}
+	return s == "name" || s == "namespace" || strings.Contains(s, ".")
+}
+
+// parseFilter parses a filter of the form [field:]text or [field:]/regex/.
+func parseFilter(s string) (itemFilter, error) {
+	var f itemFilter
+	if pos := strings.Index(s, ":"); pos > 0 && isScopedField(s[:pos]) {
+		f.field = s[:pos]
+		s = s[pos+1:]
+	}
+	if len(s) >= 2 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/") {
+		re, err := regexp.Compile(s[1 : len(s)-1])
+		if err != nil {
+			return f, errors.Wrapf(err, "filter %s", s)
+		}
+		f.re = re
+		return f, nil
+	}
+	f.substr = s
+	return f, nil
+}
+
+// parseListQuery returns a list query for the supplied filter and sort parameters. Sort
+// parameters are comma-separated field names, optionally prefixed with "-" for descending
+// order. It returns nil if there is nothing to do.
+func parseListQuery(filters []string, sorts []string) (*listQuery, error) {
+	var q listQuery
+	for _, s := range filters {
+		if s == "" {
+			continue
+		}
+		f, err := parseFilter(s)
+		if err != nil {
+			return nil, err
+		}
+		q.filters = append(q.filters, f)
+	}
+	for _, s := range sorts {
+		for _, field := range strings.Split(s, ",") {
+			field = strings.TrimSpace(field)
+			var desc bool
+			if strings.HasPrefix(field, "-") {
+				desc = true
+				field = field[1:]
+			}
+			if field == "" {
+				continue
+			}
+			q.sorts = append(q.sorts, sortKey{field: field, desc: desc})
+		}
+	}
+	if len(q.filters) == 0 && len(q.sorts) == 0 {
+		return nil, nil
+	}
+	return &q, nil
+}
+
+// labels returns the labels from the flattened label column of a row.
+func (t *tableRow) labels() map[string]string {
+	ret := map[string]string{}
+	for _, pair := range strings.Split(t.values["metadata.labels"], ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) == 2 {
+			ret[parts[0]] = parts[1]
+		}
+	}
+	return ret
+}
+
+// value returns the value of the supplied field in the row. Besides flattened column names,
+// "name", "namespace" and "labels.<key>" are supported and a bare name is looked up under
+// the derived fields if not found otherwise.
+func (t *tableRow) value(field string) (string, bool) {
+	switch {
+	case field == "name":
+		field = "metadata.name"
+	case field == "namespace":
+		field = "metadata.namespace"
+	case strings.HasPrefix(field, "labels."):
+		v, ok := t.labels()[field[len("labels."):]]
+		return v, ok
+	}
+	if v, ok := t.values[field]; ok {
+		return v, true
+	}
+	v, ok := t.values["derived."+field]
+	return v, ok
+}
+
+func (q *listQuery) matches(row *tableRow) bool {
+	for _, f := range q.filters {
+		if f.field != "" {
+			v, ok := row.value(f.field)
+			if !ok || !f.matchValue(v) {
+				return false
+			}
+			continue
+		}
+		candidates := []string{row.values["metadata.name"]}
+		for _, v := range row.labels() {
+			candidates = append(candidates, v)
+		}
+		for _, c := range row.columns {
+			if strings.HasPrefix(c, "derived.") {
+				candidates = append(candidates, row.values[c])
+			}
+		}
+		found := false
+		for _, c := range candidates {
+			if f.matchValue(c) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// compareValues compares two values numerically if both are numbers, as quantities if
+// both are resource quantities such as "500m" or "1Gi" and as strings otherwise.
+func compareValues(a, b string) int {
+	af, aErr := strconv.ParseFloat(a, 64)
+	bf, bErr := strconv.ParseFloat(b, 64)
+	if aErr == nil && bErr == nil {
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		default:
+			return 0
+		}
+	}
+	aq, aErr := resource.ParseQuantity(a)
+	bq, bErr := resource.ParseQuantity(b)
+	if aErr == nil && bErr == nil {
+		return aq.Cmp(bq)
+	}
+	return strings.Compare(a, b)
+}
+
+func (q *listQuery) less(a, b *tableRow) bool {
+	for _, s := range q.sorts {
+		av, _ := a.value(s.field)
+		bv, _ := b.value(s.field)
+		c := compareValues(av, bv)
+		if c == 0 {
+			continue
+		}
+		if s.desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dimfeld/httptreemux"
+)
+
+// requestIDHeader is the response header with the ID of the request. The ID is also
+// recorded in the log entries of the request and of its Kubernetes API calls.
+const requestIDHeader = "X-Request-Id"
+
+type loggerKey struct{}
+
+// withLogger returns a context that carries the supplied logger.
+func withLogger(reqCtx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(reqCtx, loggerKey{}, l)
+}
+
+// loggerFrom returns the logger of the supplied context, if any.
+func loggerFrom(reqCtx context.Context) (*slog.Logger, bool) {
+	l, ok := reqCtx.Value(loggerKey{}).(*slog.Logger)
+	return l, ok
+}
+
+// requestLogger returns the logger of the supplied context or the default logger.
+func requestLogger(reqCtx context.Context) *slog.Logger {
+	if l, ok := loggerFrom(reqCtx); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// withLogAttrs returns a context whose logger records the supplied attributes.
+func withLogAttrs(reqCtx context.Context, args ...interface{}) context.Context {
+	return withLogger(reqCtx, requestLogger(reqCtx).With(args...))
+}
+
+// withContextLogAttr returns a handler that records the kube context of the route,
+// if any, in all log entries for the request.
+func withContextLogAttr(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ctx := httptreemux.ContextParams(r.Context())[contextParamName]; ctx != "" {
+			r = r.WithContext(withLogAttrs(r.Context(), "context", ctx))
+		}
+		h(w, r)
+	}
+}
+
+// newRequestID returns a random request ID.
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestURI returns the URI of the request for logging, without the launch token.
+func requestURI(r *http.Request) string {
+	q := r.URL.Query()
+	if q.Get(tokenQueryParam) == "" {
+		return r.URL.RequestURI()
+	}
+	q.Set(tokenQueryParam, "redacted")
+	u := *r.URL
+	u.RawQuery = q.Encode()
+	return u.RequestURI()
+}
+
+// requestLogHandler assigns an ID to every request, returns it in a response header,
+// adds a logger with the ID to the request context and logs the request. Successful
+// requests are logged at debug level, failed requests as warnings.
+type requestLogHandler struct {
+	delegate http.Handler
+}
+
+// ServeHTTP implements the handler interface.
+func (h *requestLogHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := newRequestID()
+	w.Header().Set(requestIDHeader, id)
+	l := slog.Default().With("request_id", id)
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	start := time.Now()
+	h.delegate.ServeHTTP(rec, r.WithContext(withLogger(r.Context(), l)))
+	level := slog.LevelDebug
+	if rec.status < 200 || rec.status >= 400 {
+		level = slog.LevelWarn
+	}
+	l.Log(r.Context(), level, "request", "method", r.Method, "uri", requestURI(r), "status", rec.status, "duration", time.Since(start))
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestRequestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	client := &http.Client{Transport: &downstreamTransport{
+		ctx: "dev",
+		m:   newServerMetrics(),
+		delegate: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 404, Body: http.NoBody, Request: r}, nil
+		}),
+	}}
+	h := &requestLogHandler{delegate: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqCtx := withLogAttrs(r.Context(), "context", "dev", "resource", "apps/v1:Deployment")
+		req, err := http.NewRequest("GET", "https://k8s.example.com/apis/apps/v1/deployments", nil)
+		require.Nil(t, err)
+		resp, err := client.Do(req.WithContext(reqCtx))
+		require.Nil(t, err)
+		resp.Body.Close()
+		w.WriteHeader(502)
+	})}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/contexts/dev/resources?token=secret", nil))
+	id := w.Header().Get(requestIDHeader)
+	require.NotEqual(t, "", id)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Equal(t, 2, len(lines))
+	var down, req map[string]interface{}
+	require.Nil(t, json.Unmarshal([]byte(lines[0]), &down))
+	require.Nil(t, json.Unmarshal([]byte(lines[1]), &req))
+
+	require.Equal(t, "WARN", down["level"])
+	require.Equal(t, "downstream", down["msg"])
+	require.Equal(t, id, down["request_id"])
+	require.Equal(t, "dev", down["context"])
+	require.Equal(t, "apps/v1:Deployment", down["resource"])
+	require.Equal(t, "https://k8s.example.com/apis/apps/v1/deployments", down["url"])
+	require.Equal(t, float64(404), down["status"])
+
+	require.Equal(t, "WARN", req["level"])
+	require.Equal(t, id, req["request_id"])
+	require.Equal(t, float64(502), req["status"])
+	require.Equal(t, "/api/contexts/dev/resources?token=redacted", req["uri"])
+}
+
+func TestDownstreamLogLevels(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	tests := []struct {
+		status int
+		err    error
+		level  string
+	}{
+		{200, nil, "DEBUG"},
+		{404, nil, "WARN"},
+		{0, errors.New("connection refused"), "ERROR"},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		rt := &downstreamTransport{
+			ctx: "dev",
+			m:   newServerMetrics(),
+			delegate: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				if test.err != nil {
+					return nil, test.err
+				}
+				return &http.Response{StatusCode: test.status, Body: http.NoBody, Request: r}, nil
+			}),
+		}
+		_, err := rt.RoundTrip(httptest.NewRequest("GET", "https://k8s.example.com/api/v1/pods", nil))
+		require.Equal(t, test.err, err)
+		var entry map[string]interface{}
+		require.Nil(t, json.Unmarshal(buf.Bytes(), &entry))
+		require.Equal(t, test.level, entry["level"])
+		require.Equal(t, "dev", entry["context"])
+	}
+}
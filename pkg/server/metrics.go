@@ -0,0 +1,274 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsContentType is the content type of the Prometheus text exposition format.
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// durationBuckets are the upper bounds of the buckets of duration histograms in seconds.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// series is a single labeled value of a metric family.
+type series struct {
+	labels  []string
+	value   float64  // counter or gauge value
+	buckets []uint64 // cumulative bucket counts for histograms
+	sum     float64
+	count   uint64
+}
+
+// family is a metric with a fixed set of label names and one series per
+// distinct set of label values.
+type family struct {
+	l      *sync.Mutex
+	name   string
+	help   string
+	kind   string // counter, gauge or histogram
+	labels []string
+	series map[string]*series
+}
+
+// get returns the series for the supplied label values, creating it as needed.
+// The caller must hold the lock.
+func (f *family) get(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s: want %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s := f.series[key]
+	if s == nil {
+		s = &series{labels: values}
+		if f.kind == "histogram" {
+			s.buckets = make([]uint64, len(durationBuckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// add adds the supplied value to a counter or gauge.
+func (f *family) add(v float64, values ...string) {
+	f.l.Lock()
+	defer f.l.Unlock()
+	f.get(values).value += v
+}
+
+// inc increments a counter.
+func (f *family) inc(values ...string) {
+	f.add(1, values...)
+}
+
+// observe records a value in a histogram.
+func (f *family) observe(v float64, values ...string) {
+	f.l.Lock()
+	defer f.l.Unlock()
+	s := f.get(values)
+	for i, b := range durationBuckets {
+		if v <= b {
+			s.buckets[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// metricsRegistry is a minimal registry of metric families that can be written in
+// the Prometheus text format.
+type metricsRegistry struct {
+	l        sync.Mutex
+	families []*family
+}
+
+func (m *metricsRegistry) newFamily(kind, name, help string, labels ...string) *family {
+	f := &family{l: &m.l, name: name, help: help, kind: kind, labels: labels, series: map[string]*series{}}
+	m.families = append(m.families, f)
+	return f
+}
+
+// labelString formats label names and values, with an optional extra label.
+func labelString(names, values []string, extra ...string) string {
+	var parts []string
+	for i, n := range names {
+		parts = append(parts, fmt.Sprintf("%s=%q", n, values[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=%q", extra[i], extra[i+1]))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// write writes all metrics in the Prometheus text format.
+func (m *metricsRegistry) write(w io.Writer) {
+	m.l.Lock()
+	defer m.l.Unlock()
+	for _, f := range m.families {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+		var keys []string
+		for k := range f.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s := f.series[k]
+			if f.kind != "histogram" {
+				fmt.Fprintf(w, "%s%s %s\n", f.name, labelString(f.labels, s.labels), formatFloat(s.value))
+				continue
+			}
+			for i, b := range durationBuckets {
+				fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, labelString(f.labels, s.labels, "le", formatFloat(b)), s.buckets[i])
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, labelString(f.labels, s.labels, "le", "+Inf"), s.count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", f.name, labelString(f.labels, s.labels), formatFloat(s.sum))
+			fmt.Fprintf(w, "%s_count%s %d\n", f.name, labelString(f.labels, s.labels), s.count)
+		}
+	}
+}
+
+// serverMetrics are the metrics maintained by the server.
+type serverMetrics struct {
+	metricsRegistry
+	requests           *family
+	requestDuration    *family
+	inFlight           *family
+	downstream         *family
+	downstreamDuration *family
+	discoveryDuration  *family
+	cache              *family
+}
+
+func newServerMetrics() *serverMetrics {
+	m := &serverMetrics{}
+	m.requests = m.newFamily("counter", "kui_http_requests_total", "HTTP requests by route, method and status code.", "route", "method", "code")
+	m.requestDuration = m.newFamily("histogram", "kui_http_request_duration_seconds", "HTTP request duration by route.", "route")
+	m.inFlight = m.newFamily("gauge", "kui_http_requests_in_flight", "HTTP requests, including streamed responses, currently being served.")
+	m.downstream = m.newFamily("counter", "kui_downstream_requests_total", "Kubernetes API requests by context, resource and status code.", "context", "resource", "code")
+	m.downstreamDuration = m.newFamily("histogram", "kui_downstream_request_duration_seconds", "Kubernetes API response time by context and resource.", "context", "resource")
+	m.discoveryDuration = m.newFamily("histogram", "kui_registry_discovery_duration_seconds", "Resource discovery duration by context.", "context")
+	m.cache = m.newFamily("counter", "kui_cache_requests_total", "Cache lookups by cache and result.", "cache", "result")
+	m.inFlight.add(0)
+	return m
+}
+
+// cacheLookup records a lookup of the named cache.
+func (m *serverMetrics) cacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cache.inc(cache, result)
+}
+
+// statusRecorder records the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// instrument returns a handler that records request metrics for the supplied route.
+func (m *serverMetrics) instrument(route string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		m.inFlight.add(1)
+		defer m.inFlight.add(-1)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h(rec, r)
+		m.requests.inc(route, r.Method, strconv.Itoa(rec.status))
+		m.requestDuration.observe(time.Since(start).Seconds(), route)
+	}
+}
+
+// downstreamResource returns the resource name of a Kubernetes API path, for example
+// "pods" for /api/v1/namespaces/default/pods/foo, or "discovery" for group version paths.
+func downstreamResource(p string) string {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	var prefix int
+	switch parts[0] {
+	case "api":
+		prefix = 2
+	case "apis":
+		prefix = 3
+	default:
+		return "other"
+	}
+	if len(parts) <= prefix {
+		return "discovery"
+	}
+	parts = parts[prefix:]
+	if parts[0] == "namespaces" && len(parts) >= 3 {
+		parts = parts[2:]
+	}
+	return parts[0]
+}
+
+// downstreamTransport records metrics and logs the Kubernetes API requests of a context.
+// Requests are logged with the logger of the request context, if any, such that they
+// can be correlated with the browser request that caused them.
+type downstreamTransport struct {
+	ctx      string
+	m        *serverMetrics
+	delegate http.RoundTripper
+}
+
+// RoundTrip implements the round tripper interface.
+func (t *downstreamTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.delegate.RoundTrip(r)
+	d := time.Since(start)
+	resource := downstreamResource(r.URL.Path)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	t.m.downstream.inc(t.ctx, resource, code)
+	t.m.downstreamDuration.observe(d.Seconds(), t.ctx, resource)
+
+	l, ok := loggerFrom(r.Context())
+	if !ok {
+		l = slog.Default().With("context", t.ctx)
+	}
+	args := []interface{}{"method", r.Method, "url", r.URL.String(), "duration", d}
+	switch {
+	case err != nil:
+		l.Error("downstream", append(args, "error", err)...)
+	case resp.StatusCode >= 400:
+		l.Warn("downstream", append(args, "status", resp.StatusCode)...)
+	default:
+		l.Debug("downstream", append(args, "status", resp.StatusCode)...)
+	}
+	return resp, err
+}
+
+// CloseIdleConnections closes the idle connections of the delegate, if supported.
+func (t *downstreamTransport) CloseIdleConnections() {
+	if ci, ok := t.delegate.(interface{ CloseIdleConnections() }); ok {
+		ci.CloseIdleConnections()
+	}
+}
+
+// getMetrics writes the server metrics in the Prometheus text format.
+func (s *server) getMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metricsContentType)
+	s.metrics.write(w)
+}
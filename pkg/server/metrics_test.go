@@ -0,0 +1,58 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownstreamResource(t *testing.T) {
+	tests := map[string]string{
+		"/api/v1/namespaces/default/pods/foo":                   "pods",
+		"/api/v1/namespaces/default/pods":                       "pods",
+		"/api/v1/namespaces/default":                            "namespaces",
+		"/api/v1/nodes":                                         "nodes",
+		"/apis/apps/v1/namespaces/kube-system/deployments":      "deployments",
+		"/apis/authorization.k8s.io/v1/selfsubjectrulesreviews": "selfsubjectrulesreviews",
+		"/apis/apps/v1":                                         "discovery",
+		"/api":                                                  "discovery",
+		"/version":                                              "other",
+		"/apis/metrics.k8s.io/v1beta1/namespaces/default/pods/foo/x": "pods",
+	}
+	for p, expected := range tests {
+		require.Equal(t, expected, downstreamResource(p), p)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := newServerMetrics()
+	h := m.instrument("/api/contexts/:context", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(404)
+		}
+	})
+	h(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/contexts/dev", nil))
+	h(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/contexts/dev?fail=1", nil))
+	h(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/contexts/prod", nil))
+	m.cacheLookup("registry", true)
+	m.cacheLookup("registry", false)
+	m.discoveryDuration.observe(0.3, "dev")
+
+	var buf bytes.Buffer
+	m.write(&buf)
+	out := buf.String()
+	require.Contains(t, out, "# TYPE kui_http_requests_total counter\n")
+	require.Contains(t, out, `kui_http_requests_total{route="/api/contexts/:context",method="GET",code="200"} 2`+"\n")
+	require.Contains(t, out, `kui_http_requests_total{route="/api/contexts/:context",method="GET",code="404"} 1`+"\n")
+	require.Contains(t, out, `kui_http_request_duration_seconds_count{route="/api/contexts/:context"} 3`+"\n")
+	require.Contains(t, out, "kui_http_requests_in_flight 0\n")
+	require.Contains(t, out, `kui_cache_requests_total{cache="registry",result="hit"} 1`+"\n")
+	require.Contains(t, out, `kui_cache_requests_total{cache="registry",result="miss"} 1`+"\n")
+	require.Contains(t, out, `kui_registry_discovery_duration_seconds_bucket{context="dev",le="0.25"} 0`+"\n")
+	require.Contains(t, out, `kui_registry_discovery_duration_seconds_bucket{context="dev",le="0.5"} 1`+"\n")
+	require.Contains(t, out, `kui_registry_discovery_duration_seconds_bucket{context="dev",le="+Inf"} 1`+"\n")
+	require.Contains(t, out, `kui_registry_discovery_duration_seconds_sum{context="dev"} 0.3`+"\n")
+}
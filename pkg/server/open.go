@@ -0,0 +1,111 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dimfeld/httptreemux"
+	"github.com/gotwarlost/kui/pkg/registry"
+)
+
+// namespace path segments of deep links that select all namespaces or cluster objects.
+const (
+	allNamespacesSegment = "all"
+	clusterSegment       = "cluster"
+)
+
+// findResource returns the resource with the supplied name, which may be the plural
+// API path name ("deployments"), a name qualified with the group ("deployments.apps")
+// or the kind. Resources in the core group are preferred when names are ambiguous.
+func findResource(resources []registry.ResourceInfo, name string) (registry.ResourceInfo, bool) {
+	var (
+		found registry.ResourceInfo
+		ok    bool
+	)
+	name = strings.ToLower(name)
+	for _, ri := range resources {
+		group := ri.Key.ResourceVersion.Group()
+		match := ri.APIPathName == name ||
+			strings.ToLower(ri.Key.Kind) == name ||
+			(group != "" && ri.APIPathName+"."+group == name)
+		if !match {
+			continue
+		}
+		if !ok || group == "" || (found.Key.ResourceVersion.Group() != "" && group < found.Key.ResourceVersion.Group()) {
+			found, ok = ri, true
+		}
+	}
+	return found, ok
+}
+
+// deepLinkPath returns the UI path for a deep link of the form
+// context[/namespace[/resource[/name]]]. The namespace may be "all" for all
+// namespaces or "cluster" for cluster objects.
+func deepLinkPath(resources []registry.ResourceInfo, link string) (string, error) {
+	parts := strings.Split(strings.Trim(link, "/"), "/")
+	if parts[0] == "" || len(parts) > 4 {
+		return "", fmt.Errorf("invalid link %q, must be context[/namespace[/resource[/name]]]", link)
+	}
+	p := "/ui/" + url.PathEscape(parts[0])
+	if len(parts) == 1 {
+		return p, nil
+	}
+	ns := parts[1]
+	switch ns {
+	case allNamespacesSegment, clusterSegment:
+		p += "/" + ns
+		ns = ""
+	default:
+		p += "/ns," + url.PathEscape(ns)
+	}
+	if len(parts) == 2 {
+		return p, nil
+	}
+	ri, ok := findResource(resources, parts[2])
+	if !ok {
+		return "", fmt.Errorf("unknown resource %q", parts[2])
+	}
+	q := url.Values{}
+	q.Set("lr", ri.Key.String())
+	q.Set("lt", ri.PluralName)
+	if len(parts) == 4 {
+		q.Set("or", ri.Key.String())
+		q.Set("ons", ns)
+		q.Set("on", parts[3])
+	}
+	return p + "?" + q.Encode(), nil
+}
+
+// openLink redirects a deep link to the corresponding UI page.
+func (s *server) openLink(w http.ResponseWriter, r *http.Request) {
+	p := httptreemux.ContextParams(r.Context())
+	link := p["link"]
+	ctx := strings.Split(link, "/")[0]
+
+	cfg, err := s.getConfig()
+	if err != nil {
+		writeError(w, 500, reasonConfigError, err)
+		return
+	}
+	if !cfg.IsValidContext(ctx) {
+		writeErrorMessage(w, 400, reasonBadRequest, "invalid context: "+ctx)
+		return
+	}
+	var resources []registry.ResourceInfo
+	if strings.Count(strings.Trim(link, "/"), "/") >= 2 {
+		rr, err := s.getRegistry(cfg, ctx)
+		if err != nil {
+			writeError(w, 500, reasonRegistryError, err)
+			return
+		}
+		resources = rr.AllResources()
+	}
+	target, err := deepLinkPath(resources, link)
+	if err != nil {
+		writeError(w, 400, reasonBadRequest, err)
+		return
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/gotwarlost/kui/pkg/registry"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeepLinkPath(t *testing.T) {
+	resources := []registry.ResourceInfo{
+		{Key: registry.ResourceKey{ResourceVersion: "v1", Kind: "Pod"}, APIPathName: "pods", PluralName: "Pods"},
+		{Key: registry.ResourceKey{ResourceVersion: "extensions/v1beta1", Kind: "Deployment"}, APIPathName: "deployments", PluralName: "Deployments"},
+		{Key: registry.ResourceKey{ResourceVersion: "apps/v1", Kind: "Deployment"}, APIPathName: "deployments", PluralName: "Deployments"},
+		{Key: registry.ResourceKey{ResourceVersion: "v1", Kind: "Node"}, APIPathName: "nodes", PluralName: "Nodes", IsClusterResource: true},
+	}
+	tests := []struct {
+		link     string
+		expected string
+	}{
+		{"dev", "/ui/dev"},
+		{"dev/kube-system", "/ui/dev/ns,kube-system"},
+		{"dev/all", "/ui/dev/all"},
+		{"dev/ns1/pods", "/ui/dev/ns,ns1?lr=v1%3APod&lt=Pods"},
+		{"dev/ns1/pods/foo", "/ui/dev/ns,ns1?lr=v1%3APod&lt=Pods&on=foo&ons=ns1&or=v1%3APod"},
+		{"dev/ns1/Pod/foo", "/ui/dev/ns,ns1?lr=v1%3APod&lt=Pods&on=foo&ons=ns1&or=v1%3APod"},
+		{"dev/ns1/deployments", "/ui/dev/ns,ns1?lr=apps%2Fv1%3ADeployment&lt=Deployments"},
+		{"dev/ns1/deployments.extensions", "/ui/dev/ns,ns1?lr=extensions%2Fv1beta1%3ADeployment&lt=Deployments"},
+		{"dev/cluster/nodes/n1", "/ui/dev/cluster?lr=v1%3ANode&lt=Nodes&on=n1&ons=&or=v1%3ANode"},
+	}
+	for _, test := range tests {
+		t.Run(test.link, func(t *testing.T) {
+			p, err := deepLinkPath(resources, test.link)
+			require.Nil(t, err)
+			require.Equal(t, test.expected, p)
+		})
+	}
+
+	_, err := deepLinkPath(resources, "dev/ns1/widgets")
+	require.NotNil(t, err)
+	_, err = deepLinkPath(resources, "dev/ns1/pods/foo/bar")
+	require.NotNil(t, err)
+	_, err = deepLinkPath(resources, "")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dimfeld/httptreemux"
+	"github.com/gotwarlost/kui/pkg/registry"
+	authv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	rulesReviewPath  = "/apis/authorization.k8s.io/v1/selfsubjectrulesreviews"
+	accessReviewPath = "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews"
+	maxAccessReviews = 10 // maximum number of concurrent access reviews
+)
+
+// standardVerbs are the verbs reported for every resource, in display order.
+var standardVerbs = []string{"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection"}
+
+// readVerbs are the verbs checked individually for cluster resources.
+var readVerbs = []string{"get", "list", "watch"}
+
+// allNamespacesVerbs are the verbs checked individually for namespaced resources when
+// no namespace is selected.
+var allNamespacesVerbs = []string{"list", "watch"}
+
+// PermissionList reports the verbs the current user has on every resource of a context.
+type PermissionList struct {
+	Namespace  string              `json:"namespace"`            // the namespace checked, empty for all namespaces
+	User       string              `json:"user,omitempty"`       // the impersonated user, if any
+	Groups     []string            `json:"groups,omitempty"`     // the impersonated groups, if any
+	Incomplete bool                `json:"incomplete,omitempty"` // true if the authorizer could not enumerate all rules
+	Resources  map[string][]string `json:"resources"`            // allowed verbs keyed by resource ID
+	Errors     []string            `json:"errors,omitempty"`     // evaluation or request errors, if any
+}
+
+// ruleMatches returns true if the supplied rule applies to all objects of the
+// supplied resource. Rules restricted to specific object names are not considered
+// since they do not allow the resource to be listed.
+func ruleMatches(rule authv1.ResourceRule, ri registry.ResourceInfo) bool {
+	if len(rule.ResourceNames) > 0 {
+		return false
+	}
+	group := ri.Key.ResourceVersion.Group()
+	groupOK := false
+	for _, g := range rule.APIGroups {
+		if g == "*" || g == group {
+			groupOK = true
+			break
+		}
+	}
+	if !groupOK {
+		return false
+	}
+	for _, r := range rule.Resources {
+		if r == "*" || r == ri.APIPathName {
+			return true
+		}
+	}
+	return false
+}
+
+// verbsFor returns the standard verbs allowed on the supplied resource by the rules.
+func verbsFor(rules []authv1.ResourceRule, ri registry.ResourceInfo) []string {
+	allowed := map[string]bool{}
+	for _, rule := range rules {
+		if !ruleMatches(rule, ri) {
+			continue
+		}
+		for _, v := range rule.Verbs {
+			allowed[strings.ToLower(v)] = true
+		}
+	}
+	ret := []string{}
+	for _, v := range standardVerbs {
+		if allowed["*"] || allowed[v] {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// reviewRules returns the resource rules for the current user in the supplied namespace.
+func reviewRules(reqCtx context.Context, c *conn, namespace string) (*authv1.SubjectRulesReviewStatus, error) {
+	review := authv1.SelfSubjectRulesReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "authorization.k8s.io/v1", Kind: "SelfSubjectRulesReview"},
+		Spec:     authv1.SelfSubjectRulesReviewSpec{Namespace: namespace},
+	}
+	var out authv1.SelfSubjectRulesReview
+	if err := c.postJSON(reqCtx, rulesReviewPath, review, &out); err != nil {
+		return nil, err
+	}
+	return &out.Status, nil
+}
+
+// reviewAccess returns true if the current user may perform the verb on the
+// resource in the supplied namespace, or in all namespaces if empty.
+func reviewAccess(reqCtx context.Context, c *conn, ri registry.ResourceInfo, namespace, verb string) (bool, error) {
+	if ri.IsClusterResource {
+		namespace = ""
+	}
+	review := authv1.SelfSubjectAccessReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "authorization.k8s.io/v1", Kind: "SelfSubjectAccessReview"},
+		Spec: authv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      verb,
+				Group:     ri.Key.ResourceVersion.Group(),
+				Resource:  ri.APIPathName,
+			},
+		},
+	}
+	var out authv1.SelfSubjectAccessReview
+	if err := c.postJSON(reqCtx, accessReviewPath, review, &out); err != nil {
+		return false, err
+	}
+	return out.Status.Allowed, nil
+}
+
+// reviewVerbs checks the supplied verbs for every resource with individual access
+// reviews in the supplied namespace, or in all namespaces if empty. This is used for
+// cluster resources, since the rules of a namespace may include rules for cluster
+// resources that only apply to the namespace, and for namespaced resources when no
+// namespace is selected, since rules can only be reviewed for a single namespace.
+func reviewVerbs(reqCtx context.Context, c *conn, resources []registry.ResourceInfo, namespace string, verbs []string) (map[string][]string, []string) {
+	var (
+		l    sync.Mutex
+		wg   sync.WaitGroup
+		errs []string
+	)
+	sem := make(chan struct{}, maxAccessReviews)
+	ret := map[string][]string{}
+	for _, ri := range resources {
+		ret[ri.Key.String()] = []string{}
+	}
+	for _, ri := range resources {
+		for _, verb := range verbs {
+			wg.Add(1)
+			go func(ri registry.ResourceInfo, verb string) {
+				defer wg.Done()
+				sem <- struct{}{}
+				allowed, err := reviewAccess(reqCtx, c, ri, namespace, verb)
+				<-sem
+				l.Lock()
+				defer l.Unlock()
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("%s %s: %v", verb, ri.PluralName, err))
+					return
+				}
+				if allowed {
+					ret[ri.Key.String()] = append(ret[ri.Key.String()], verb)
+				}
+			}(ri, verb)
+		}
+	}
+	wg.Wait()
+	for _, verbs := range ret {
+		sortVerbs(verbs)
+	}
+	sort.Strings(errs)
+	return ret, errs
+}
+
+// sortVerbs sorts verbs in the order of the standard verbs.
+func sortVerbs(verbs []string) {
+	pos := map[string]int{}
+	for i, v := range standardVerbs {
+		pos[v] = i
+	}
+	sort.Slice(verbs, func(i, j int) bool { return pos[verbs[i]] < pos[verbs[j]] })
+}
+
+// getPermissions returns the verbs the current user, or the impersonated user, has
+// on every resource of the context. Namespaced resources use a single rules review
+// for the supplied namespace. When no namespace is supplied, the list and watch verbs
+// of namespaced resources are checked across all namespaces with access reviews. The
+// read verbs of cluster resources are always checked with access reviews.
+func (s *server) getPermissions(w http.ResponseWriter, r *http.Request) {
+	p := httptreemux.ContextParams(r.Context())
+	cfg, err := s.getConfig()
+	if err != nil {
+		writeError(w, 500, reasonConfigError, err)
+		return
+	}
+
+	r.ParseForm()
+
+	ctx := p[contextParamName]
+	ns := r.Form.Get(namespaceQueryParam)
+
+	if !cfg.IsValidContext(ctx) {
+		writeErrorMessage(w, 400, reasonBadRequest, "invalid context: "+ctx)
+		return
+	}
+	rr, err := s.getRegistry(cfg, ctx)
+	if err != nil {
+		writeError(w, 500, reasonRegistryError, err)
+		return
+	}
+	imp, err := s.impersonationFor(r, ctx)
+	if err != nil {
+		writeErrorMessage(w, 400, reasonBadRequest, "invalid impersonation: "+err.Error())
+		return
+	}
+	conn, err := s.getConn(cfg, ctx, imp)
+	if err != nil {
+		writeError(w, 500, reasonConnectionError, err)
+		return
+	}
+
+	ret := PermissionList{
+		Namespace: ns,
+		User:      imp.User,
+		Groups:    imp.Groups,
+	}
+	ret.Resources = map[string][]string{}
+	var clusterResources, namespacedResources []registry.ResourceInfo
+	for _, ri := range rr.AllResources() {
+		if ri.IsClusterResource {
+			clusterResources = append(clusterResources, ri)
+		} else {
+			namespacedResources = append(namespacedResources, ri)
+		}
+	}
+	addReviews := func(resources []registry.ResourceInfo, verbs []string) {
+		if len(resources) == 0 {
+			return
+		}
+		allowed, errs := reviewVerbs(r.Context(), conn, resources, "", verbs)
+		for k, v := range allowed {
+			ret.Resources[k] = v
+		}
+		ret.Errors = append(ret.Errors, errs...)
+	}
+
+	if ns == "" {
+		addReviews(namespacedResources, allNamespacesVerbs)
+	} else {
+		status, err := reviewRules(r.Context(), conn, ns)
+		if err != nil {
+			writeDownstreamError(w, err)
+			return
+		}
+		ret.Incomplete = status.Incomplete
+		if status.EvaluationError != "" {
+			ret.Errors = append(ret.Errors, status.EvaluationError)
+		}
+		for _, ri := range namespacedResources {
+			ret.Resources[ri.Key.String()] = verbsFor(status.ResourceRules, ri)
+		}
+	}
+	addReviews(clusterResources, readVerbs)
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.Encode(ret)
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/gotwarlost/kui/pkg/registry"
+	"github.com/stretchr/testify/require"
+	authv1 "k8s.io/api/authorization/v1"
+)
+
+func TestPermissionVerbs(t *testing.T) {
+	pods := registry.ResourceInfo{
+		Key:         registry.ResourceKey{ResourceVersion: "v1", Kind: "Pod"},
+		APIPathName: "pods",
+	}
+	deployments := registry.ResourceInfo{
+		Key:         registry.ResourceKey{ResourceVersion: "apps/v1", Kind: "Deployment"},
+		APIPathName: "deployments",
+	}
+	secrets := registry.ResourceInfo{
+		Key:         registry.ResourceKey{ResourceVersion: "v1", Kind: "Secret"},
+		APIPathName: "secrets",
+	}
+	rules := []authv1.ResourceRule{
+		{Verbs: []string{"list", "get"}, APIGroups: []string{""}, Resources: []string{"pods", "pods/log"}},
+		{Verbs: []string{"watch"}, APIGroups: []string{"*"}, Resources: []string{"*"}},
+		{Verbs: []string{"*"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}},
+		{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"tls"}},
+	}
+	require.Equal(t, []string{"get", "list", "watch"}, verbsFor(rules, pods))
+	require.Equal(t, standardVerbs, verbsFor(rules, deployments))
+	require.Equal(t, []string{"watch"}, verbsFor(rules, secrets))
+	require.Equal(t, []string{}, verbsFor(nil, pods))
+
+	verbs := []string{"watch", "get", "list"}
+	sortVerbs(verbs)
+	require.Equal(t, readVerbs, verbs)
+}
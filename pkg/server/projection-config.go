@@ -0,0 +1,154 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/gotwarlost/kui/pkg/registry"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// ColumnConfig is a single column of a declarative projection.
+type ColumnConfig struct {
+	Name     string `json:"name"`     // the name of the column, used as the key in derived data
+	JSONPath string `json:"jsonPath"` // a JSONPath expression, with or without enclosing braces
+}
+
+// ProjectionConfig is a declarative projection for a single kind.
+type ProjectionConfig struct {
+	Kind    string         `json:"kind"`    // resource key, for example "example.com/:Widget"
+	Columns []ColumnConfig `json:"columns"` // columns to derive from the object
+}
+
+// ProjectionsFile is the structure of a YAML file containing declarative projections.
+type ProjectionsFile struct {
+	Projections []ProjectionConfig `json:"projections"`
+}
+
+// relaxedJSONPath wraps the supplied expression in braces, if needed, and adds
+// a leading dot when missing so that "spec.foo", ".spec.foo" and "{.spec.foo}"
+// are all acceptable.
+func relaxedJSONPath(expr string) string {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "{") && strings.HasSuffix(expr, "}") {
+		return expr
+	}
+	if !strings.HasPrefix(expr, ".") {
+		expr = "." + expr
+	}
+	return "{" + expr + "}"
+}
+
+// parseColumns returns parsed JSONPath expressions for the supplied columns.
+func parseColumns(columns []ColumnConfig) ([]*jsonpath.JSONPath, error) {
+	var ret []*jsonpath.JSONPath
+	for _, c := range columns {
+		jp := jsonpath.New(c.Name)
+		jp.AllowMissingKeys(true)
+		if err := jp.Parse(relaxedJSONPath(c.JSONPath)); err != nil {
+			return nil, errors.Wrapf(err, "column %s", c.Name)
+		}
+		ret = append(ret, jp)
+	}
+	return ret, nil
+}
+
+// toProjectionSet validates the configuration and returns a projection set from it.
+func (pf ProjectionsFile) toProjectionSet() (projectionSet, error) {
+	ret := projectionSet{}
+	for _, pc := range pf.Projections {
+		if pc.Kind == "" {
+			return nil, fmt.Errorf("projection with no kind")
+		}
+		key, err := registry.ResourceKeyFromString(pc.Kind)
+		if err != nil {
+			return nil, errors.Wrapf(err, "projection %s", pc.Kind)
+		}
+		for _, c := range pc.Columns {
+			if c.Name == "" {
+				return nil, fmt.Errorf("projection %s: column with no name", pc.Kind)
+			}
+		}
+		if _, err := parseColumns(pc.Columns); err != nil {
+			return nil, errors.Wrapf(err, "projection %s", pc.Kind)
+		}
+		columns := pc.Columns
+		ret[key.WithEmptyVersion().String()] = func() projection {
+			paths, _ := parseColumns(columns) // already validated
+			return &jsonPathObject{columns: columns, paths: paths}
+		}
+	}
+	return ret, nil
+}
+
+// loadProjections loads declarative projections from the supplied YAML files.
+// Projections in later files override those in earlier ones.
+func loadProjections(files []string) (projectionSet, error) {
+	ret := projectionSet{}
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "read projections")
+		}
+		var pf ProjectionsFile
+		if err := yaml.Unmarshal(b, &pf); err != nil {
+			return nil, errors.Wrapf(err, "parse projections from %s", file)
+		}
+		ps, err := pf.toProjectionSet()
+		if err != nil {
+			return nil, errors.Wrapf(err, "load projections from %s", file)
+		}
+		ret = ret.merge(ps)
+	}
+	return ret, nil
+}
+
+// jsonPathObject is a projection that derives data using JSONPath expressions.
+type jsonPathObject struct {
+	defaultObject
+	columns []ColumnConfig
+	paths   []*jsonpath.JSONPath
+	data    interface{}
+}
+
+// UnmarshalJSON decodes both the standard metadata and the full object.
+func (j *jsonPathObject) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &j.defaultObject); err != nil {
+		return err
+	}
+	return json.Unmarshal(b, &j.data)
+}
+
+func (j *jsonPathObject) clear() {
+	j.defaultObject.clear()
+	j.data = nil
+}
+
+func (j *jsonPathObject) projectData(w io.Writer) error {
+	out := struct {
+		defaultObject
+		Derived map[string]string `json:"derived"`
+	}{
+		defaultObject: j.defaultObject,
+		Derived:       map[string]string{},
+	}
+	for i, jp := range j.paths {
+		var buf bytes.Buffer
+		if err := jp.Execute(&buf, j.data); err != nil {
+			return errors.Wrapf(err, "column %s", j.columns[i].Name)
+		}
+		out.Derived[j.columns[i].Name] = buf.String()
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
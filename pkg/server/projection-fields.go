@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// splitFields splits a comma-separated list of fields, ignoring commas nested inside
+// braces, brackets or parentheses so that JSONPath expressions may contain them.
+func splitFields(s string) []string {
+	var ret []string
+	depth := 0
+	start := 0
+	for i, ch := range s {
+		switch ch {
+		case '{', '[', '(':
+			depth++
+		case '}', ']', ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				ret = append(ret, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	ret = append(ret, s[start:])
+	var out []string
+	for _, f := range ret {
+		f = strings.TrimSpace(f)
+		if f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// newFieldsProjection returns a constructor for a projection that only emits the supplied
+// fields. Each field may be a dotted path (e.g. metadata.name) or a JSONPath expression.
+func newFieldsProjection(values []string) (func() projection, error) {
+	var columns []ColumnConfig
+	for _, v := range values {
+		for _, f := range splitFields(v) {
+			columns = append(columns, ColumnConfig{Name: f, JSONPath: f})
+		}
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no fields specified")
+	}
+	if _, err := parseColumns(columns); err != nil {
+		return nil, err
+	}
+	return func() projection {
+		paths, _ := parseColumns(columns) // already validated
+		return &fieldsObject{columns: columns, paths: paths}
+	}, nil
+}
+
+// fieldsObject is a projection that emits an object keyed by the requested fields.
+// Fields that are not found have a null value and fields with multiple results have
+// an array value.
+type fieldsObject struct {
+	columns []ColumnConfig
+	paths   []*jsonpath.JSONPath
+	data    interface{}
+}
+
+// UnmarshalJSON decodes the full object.
+func (f *fieldsObject) UnmarshalJSON(b []byte) error {
+	return json.Unmarshal(b, &f.data)
+}
+
+func (f *fieldsObject) clear() {
+	f.data = nil
+}
+
+func (f *fieldsObject) projectData(w io.Writer) error {
+	out := map[string]interface{}{}
+	for i, jp := range f.paths {
+		results, err := jp.FindResults(f.data)
+		if err != nil {
+			return err
+		}
+		var values []interface{}
+		for _, r := range results {
+			for _, v := range r {
+				if v.IsValid() && v.CanInterface() {
+					values = append(values, v.Interface())
+				}
+			}
+		}
+		name := f.columns[i].Name
+		switch len(values) {
+		case 0:
+			out[name] = nil
+		case 1:
+			out[name] = values[0]
+		default:
+			out[name] = values
+		}
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -7,12 +7,13 @@ import (
 	"time"
 
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
 )
 
-var projections = map[string]func() projection{
+var projections = projectionSet{
 	"apps/:DaemonSet":        func() projection { return &daemonset{} },
 	"extensions/:DaemonSet":  func() projection { return &daemonset{} },
 	"apps/:Deployment":       func() projection { return &deployment{} },
@@ -84,10 +85,11 @@ func toSelectorStringFromMap(ps map[string]string) string {
 
 type defaultObject struct {
 	Metadata struct {
-		Namespace         string            `json:"namespace"`
-		Name              string            `json:"name"`
-		Labels            map[string]string `json:"labels"`
-		CreationTimestamp *time.Time        `json:"creationTimestamp"`
+		Namespace         string                  `json:"namespace"`
+		Name              string                  `json:"name"`
+		Labels            map[string]string       `json:"labels"`
+		CreationTimestamp *time.Time              `json:"creationTimestamp"`
+		OwnerReferences   []metav1.OwnerReference `json:"ownerReferences,omitempty"`
 	} `json:"metadata"`
 }
 
@@ -96,6 +98,7 @@ func (d *defaultObject) clear() {
 	d.Metadata.Name = ""
 	d.Metadata.Labels = nil
 	d.Metadata.CreationTimestamp = nil
+	d.Metadata.OwnerReferences = nil
 }
 
 func (d *defaultObject) projectData(w io.Writer) error {
@@ -273,10 +276,72 @@ func (e *event) projectData(w io.Writer) error {
 	return err
 }
 
+// resourceTotals tracks summed CPU and memory requests and limits.
+type resourceTotals struct {
+	cpuRequests    resource.Quantity
+	cpuLimits      resource.Quantity
+	memoryRequests resource.Quantity
+	memoryLimits   resource.Quantity
+}
+
+// add adds the supplied totals to the current one.
+func (r *resourceTotals) add(other resourceTotals) {
+	r.cpuRequests.Add(other.cpuRequests)
+	r.cpuLimits.Add(other.cpuLimits)
+	r.memoryRequests.Add(other.memoryRequests)
+	r.memoryLimits.Add(other.memoryLimits)
+}
+
+// addRequirements adds the CPU and memory values of the supplied container resources.
+func (r *resourceTotals) addRequirements(req v1.ResourceRequirements) {
+	r.cpuRequests.Add(*req.Requests.Cpu())
+	r.cpuLimits.Add(*req.Limits.Cpu())
+	r.memoryRequests.Add(*req.Requests.Memory())
+	r.memoryLimits.Add(*req.Limits.Memory())
+}
+
+// maxOf sets every value to the larger of the current and supplied value.
+func (r *resourceTotals) maxOf(other resourceTotals) {
+	maxQ := func(q *resource.Quantity, o resource.Quantity) {
+		if o.Cmp(*q) > 0 {
+			*q = o
+		}
+	}
+	maxQ(&r.cpuRequests, other.cpuRequests)
+	maxQ(&r.cpuLimits, other.cpuLimits)
+	maxQ(&r.memoryRequests, other.memoryRequests)
+	maxQ(&r.memoryLimits, other.memoryLimits)
+}
+
+// summary returns the display representation of the totals.
+func (r *resourceTotals) summary() resourceSummary {
+	return resourceSummary{
+		CPURequests:    r.cpuRequests.String(),
+		CPULimits:      r.cpuLimits.String(),
+		MemoryRequests: r.memoryRequests.String(),
+		MemoryLimits:   r.memoryLimits.String(),
+	}
+}
+
+type resourceSummary struct {
+	CPURequests    string `json:"cpuRequests"`
+	CPULimits      string `json:"cpuLimits"`
+	MemoryRequests string `json:"memoryRequests"`
+	MemoryLimits   string `json:"memoryLimits"`
+}
+
+type ownerRef struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
 type pod struct {
 	defaultObject
 	Spec struct {
-		NodeName string `json:"nodeName"`
+		NodeName          string         `json:"nodeName"`
+		PriorityClassName string         `json:"priorityClassName"`
+		InitContainers    []v1.Container `json:"initContainers"`
+		Containers        []v1.Container `json:"containers"`
 	}
 	Status v1.PodStatus `json:"status"`
 }
@@ -284,20 +349,83 @@ type pod struct {
 type outPod struct {
 	defaultObject
 	Derived struct {
-		NodeName string `json:"nodeName"`
-		IP       string `json:"ip"`
-		Restarts int    `json:"restarts"`
-		Status   string `json:"status"`
-		Ready    string `json:"ready"`
+		NodeName      string          `json:"nodeName"`
+		IP            string          `json:"ip"`
+		Restarts      int             `json:"restarts"`
+		Status        string          `json:"status"`
+		Ready         string          `json:"ready"`
+		Resources     resourceSummary `json:"resources"`
+		QOSClass      string          `json:"qosClass"`
+		PriorityClass string          `json:"priorityClass,omitempty"`
+		Owner         *ownerRef       `json:"owner,omitempty"`
 	} `json:"derived"`
 }
 
 func (p *pod) clear() {
 	p.defaultObject.clear()
 	p.Spec.NodeName = ""
+	p.Spec.PriorityClassName = ""
+	p.Spec.InitContainers = nil
+	p.Spec.Containers = nil
 	p.Status = v1.PodStatus{}
 }
 
+// resources returns the effective resource totals for the pod, which is the sum of
+// all containers or the largest init container value, whichever is larger.
+func (p *pod) resources() resourceTotals {
+	var ret resourceTotals
+	for _, c := range p.Spec.Containers {
+		ret.addRequirements(c.Resources)
+	}
+	for _, c := range p.Spec.InitContainers {
+		var init resourceTotals
+		init.addRequirements(c.Resources)
+		ret.maxOf(init)
+	}
+	return ret
+}
+
+// qosClass returns the QoS class reported in the status, computing it from the
+// container resources if the status does not have it.
+func (p *pod) qosClass() string {
+	if p.Status.QOSClass != "" {
+		return string(p.Status.QOSClass)
+	}
+	containers := append(append([]v1.Container(nil), p.Spec.InitContainers...), p.Spec.Containers...)
+	names := []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory}
+	isBestEffort := true
+	isGuaranteed := true
+	for _, c := range containers {
+		for _, name := range names {
+			req, hasReq := c.Resources.Requests[name]
+			lim, hasLim := c.Resources.Limits[name]
+			if (hasReq && !req.IsZero()) || (hasLim && !lim.IsZero()) {
+				isBestEffort = false
+			}
+			if !hasLim || lim.IsZero() {
+				isGuaranteed = false
+				continue
+			}
+			if hasReq && req.Cmp(lim) != 0 {
+				isGuaranteed = false
+			}
+		}
+	}
+	switch {
+	case isBestEffort:
+		return string(v1.PodQOSBestEffort)
+	case isGuaranteed:
+		return string(v1.PodQOSGuaranteed)
+	default:
+		return string(v1.PodQOSBurstable)
+	}
+}
+
+// isTerminated returns true if the pod no longer holds resources on its node.
+func (p *pod) isTerminated() bool {
+	return p.Status.Phase == v1.PodSucceeded || p.Status.Phase == v1.PodFailed
+}
+
 func (p *pod) projectData(w io.Writer) error {
 	out := outPod{
 		defaultObject: p.defaultObject,
@@ -324,6 +452,21 @@ func (p *pod) projectData(w io.Writer) error {
 	out.Derived.Ready = fmt.Sprintf("%d / %d", ready, total)
 	out.Derived.Restarts = restarts
 
+	res := p.resources()
+	out.Derived.Resources = res.summary()
+	out.Derived.QOSClass = p.qosClass()
+	out.Derived.PriorityClass = p.Spec.PriorityClassName
+	for _, ref := range p.Metadata.OwnerReferences {
+		if ref.Controller != nil && *ref.Controller {
+			out.Derived.Owner = &ownerRef{Kind: ref.Kind, Name: ref.Name}
+			break
+		}
+	}
+	if out.Derived.Owner == nil && len(p.Metadata.OwnerReferences) > 0 {
+		ref := p.Metadata.OwnerReferences[0]
+		out.Derived.Owner = &ownerRef{Kind: ref.Kind, Name: ref.Name}
+	}
+
 	data, err := json.Marshal(out)
 	if err != nil {
 		return err
@@ -332,13 +475,26 @@ func (p *pod) projectData(w io.Writer) error {
 	return err
 }
 
+// nodeAllocation is the resources allocated to pods on a node.
+type nodeAllocation struct {
+	resourceTotals
+	pods int
+}
+
+// allocationAware is implemented by projections that can use node allocation
+// information computed from a separate pod list.
+type allocationAware interface {
+	setAllocations(allocations map[string]*nodeAllocation)
+}
+
 type node struct {
 	defaultObject
 	Spec struct {
 		PodCIDR    string `json:"podCIDR"`
 		ExternalID string `json:"externalID"`
 	}
-	Status v1.NodeStatus `json:"status"`
+	Status      v1.NodeStatus `json:"status"`
+	allocations map[string]*nodeAllocation
 }
 
 func (n *node) clear() {
@@ -348,6 +504,10 @@ func (n *node) clear() {
 	n.Status = v1.NodeStatus{}
 }
 
+func (n *node) setAllocations(allocations map[string]*nodeAllocation) {
+	n.allocations = allocations
+}
+
 func (n *node) projectData(w io.Writer) error {
 	out := outNode{
 		defaultObject: n.defaultObject,
@@ -366,6 +526,19 @@ func (n *node) projectData(w io.Writer) error {
 			}
 		}
 	}
+	out.Derived.Allocatable.CPU = n.Status.Allocatable.Cpu().String()
+	out.Derived.Allocatable.Memory = n.Status.Allocatable.Memory().String()
+	out.Derived.Allocatable.Pods = n.Status.Allocatable.Pods().String()
+	if n.allocations != nil {
+		var alloc nodeAllocation
+		if a := n.allocations[n.Metadata.Name]; a != nil {
+			alloc = *a
+		}
+		out.Derived.Allocated = &outAllocation{
+			resourceSummary: alloc.summary(),
+			Pods:            alloc.pods,
+		}
+	}
 	data, err := json.Marshal(out)
 	if err != nil {
 		return err
@@ -374,6 +547,11 @@ func (n *node) projectData(w io.Writer) error {
 	return err
 }
 
+type outAllocation struct {
+	resourceSummary
+	Pods int `json:"pods"`
+}
+
 type outNode struct {
 	defaultObject
 	Derived struct {
@@ -382,5 +560,42 @@ type outNode struct {
 		KubeletVersion string `json:"kubeletVersion"`
 		PodCIDR        string `json:"podCIDR"`
 		ExternalID     string `json:"externalID"`
+		Allocatable    struct {
+			CPU    string `json:"cpu"`
+			Memory string `json:"memory"`
+			Pods   string `json:"pods"`
+		} `json:"allocatable"`
+		Allocated *outAllocation `json:"allocated,omitempty"`
 	} `json:"derived"`
 }
+
+// computeAllocations reads a pod list and returns the resources allocated to
+// non-terminated pods keyed by node name.
+func computeAllocations(r io.Reader) (map[string]*nodeAllocation, error) {
+	df := &dataFilter{dec: json.NewDecoder(r)}
+	if err := df.skipToItems(); err != nil {
+		return nil, err
+	}
+	ret := map[string]*nodeAllocation{}
+	var p pod
+	for df.dec.More() {
+		p.clear()
+		if err := df.dec.Decode(&p); err != nil {
+			return nil, err
+		}
+		if p.Spec.NodeName == "" || p.isTerminated() {
+			continue
+		}
+		alloc := ret[p.Spec.NodeName]
+		if alloc == nil {
+			alloc = &nodeAllocation{}
+			ret[p.Spec.NodeName] = alloc
+		}
+		alloc.add(p.resources())
+		alloc.pods++
+	}
+	if err := df.endItems(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
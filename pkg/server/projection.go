@@ -1,9 +1,11 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
 )
 
 type projection interface {
@@ -12,16 +14,35 @@ type projection interface {
 }
 
 type dataFilter struct {
-	p   projection
-	dec *json.Decoder
-	w   io.Writer
+	p     projection
+	dec   *json.Decoder
+	w     io.Writer
+	query *listQuery // optional filters and sort order
 }
 
-func newFilter(r io.Reader, w io.Writer, objType string) *dataFilter {
+// projectionSet is a map of object types to projection constructors. The empty
+// key holds the default projection.
+type projectionSet map[string]func() projection
+
+// merge returns a new projection set with the supplied projections overriding
+// the current ones.
+func (ps projectionSet) merge(other projectionSet) projectionSet {
+	ret := projectionSet{}
+	for k, v := range ps {
+		ret[k] = v
+	}
+	for k, v := range other {
+		ret[k] = v
+	}
+	return ret
+}
+
+// newFilter returns a data filter that uses the projection for the supplied object type.
+func (ps projectionSet) newFilter(r io.Reader, w io.Writer, objType string) *dataFilter {
 	dec := json.NewDecoder(r)
-	p := projections[objType]
+	p := ps[objType]
 	if p == nil {
-		p = projections[""]
+		p = ps[""]
 	}
 	return &dataFilter{
 		dec: dec,
@@ -30,16 +51,34 @@ func newFilter(r io.Reader, w io.Writer, objType string) *dataFilter {
 	}
 }
 
+func newFilter(r io.Reader, w io.Writer, objType string) *dataFilter {
+	return projections.newFilter(r, w, objType)
+}
+
+// process writes projected items as a JSON object with an items key. The output is
+// always valid JSON. If the input cannot be fully processed, the items written so far
+// are followed by an error key that has the failure as a status object and the error
+// is returned.
 func (df *dataFilter) process() error {
-	if err := df.skipToItems(); err != nil {
-		return err
+	df.w.Write([]byte(`{ "items": [` + "\n"))
+	err := df.skipToItems()
+	if err == nil {
+		err = df.copyItems()
 	}
-	df.w.Write([]byte(`{ "items": `))
-	if err := df.copyItems(); err != nil {
-		return err
+	df.w.Write([]byte("\n]"))
+	if err != nil {
+		b, _ := json.Marshal(APIError{
+			Kind:    "Status",
+			Status:  "Failure",
+			Code:    502,
+			Reason:  reasonStreamError,
+			Message: err.Error(),
+		})
+		df.w.Write([]byte(`, "error": `))
+		df.w.Write(b)
 	}
 	df.w.Write([]byte("\n}\n"))
-	return nil
+	return err
 }
 
 func (df *dataFilter) skipToItems() error {
@@ -61,24 +100,109 @@ func (df *dataFilter) skipToItems() error {
 	}
 }
 
+// eachItem calls the supplied function with the projected data and flattened row of
+// every item that matches the query, in sort order if one was requested.
+func (df *dataFilter) eachItem(fn func(data []byte, row *tableRow) error) error {
+	type entry struct {
+		data []byte
+		row  *tableRow
+	}
+	var entries []entry
+	var buf bytes.Buffer
+	for df.dec.More() {
+		df.p.clear()
+		if err := df.dec.Decode(df.p); err != nil {
+			return err
+		}
+		buf.Reset()
+		if err := df.p.projectData(&buf); err != nil {
+			return err
+		}
+		row, err := flattenRow(buf.Bytes())
+		if err != nil {
+			return err
+		}
+		if df.query != nil && !df.query.matches(row) {
+			continue
+		}
+		data := append([]byte(nil), buf.Bytes()...)
+		if df.query == nil || len(df.query.sorts) == 0 {
+			if err := fn(data, row); err != nil {
+				return err
+			}
+			continue
+		}
+		entries = append(entries, entry{data: data, row: row})
+	}
+	if err := df.endItems(); err != nil {
+		return err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return df.query.less(entries[i].row, entries[j].row)
+	})
+	for _, e := range entries {
+		if err := fn(e.data, e.row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// endItems consumes the end of the items array, returning an error if the input
+// was truncated.
+func (df *dataFilter) endItems() error {
+	tok, err := df.dec.Token()
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim(']') {
+		return fmt.Errorf("unexpected token %v at end of items", tok)
+	}
+	return nil
+}
+
+// copyItems writes comma-separated projected items. Each item is projected completely
+// before it is written such that failures never result in a partial item.
 func (df *dataFilter) copyItems() error {
+	if df.query != nil {
+		return df.copyQueryItems()
+	}
 	first := true
-	df.w.Write([]byte("[\n"))
-
+	var buf bytes.Buffer
 	for df.dec.More() {
+		df.p.clear()
+		if err := df.dec.Decode(df.p); err != nil {
+			return err
+		}
+		buf.Reset()
+		if err := df.p.projectData(&buf); err != nil {
+			return err
+		}
 		if first {
 			first = false
 		} else {
 			df.w.Write([]byte(",\n"))
 		}
-		df.p.clear()
-		if err := df.dec.Decode(df.p); err != nil {
-			return err
-		}
-		if err := df.p.projectData(df.w); err != nil {
+		if _, err := buf.WriteTo(df.w); err != nil {
 			return err
 		}
 	}
-	df.w.Write([]byte("\n]"))
-	return nil
+	return df.endItems()
+}
+
+// copyQueryItems copies items after applying the filters and sort order of the query.
+func (df *dataFilter) copyQueryItems() error {
+	first := true
+	return df.eachItem(func(data []byte, row *tableRow) error {
+		if first {
+			first = false
+		} else {
+			df.w.Write([]byte(",\n"))
+		}
+		_, err := df.w.Write(data)
+		return err
+	})
 }
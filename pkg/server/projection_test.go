@@ -10,6 +10,19 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// filterPodList processes the pod list test data as the supplied object type with the
+// supplied projections and list query, and returns the output.
+func filterPodList(t *testing.T, ps projectionSet, objType string, q *listQuery) []byte {
+	b, err := ioutil.ReadFile("testdata/pod-list.json")
+	require.Nil(t, err)
+
+	var w bytes.Buffer
+	df := ps.newFilter(bytes.NewReader(b), &w, objType)
+	df.query = q
+	require.Nil(t, df.process())
+	return w.Bytes()
+}
+
 func TestProjection(t *testing.T) {
 	b, err := ioutil.ReadFile("testdata/pod-list.json")
 	require.Nil(t, err)
@@ -23,3 +36,146 @@ func TestProjection(t *testing.T) {
 	require.Nil(t, err)
 	fmt.Println(w.String())
 }
+
+func TestPodResourceProjection(t *testing.T) {
+	var out struct {
+		Items []outPod `json:"items"`
+	}
+	err := json.Unmarshal(filterPodList(t, projections, "/:Pod", nil), &out)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(out.Items))
+	first := out.Items[0].Derived
+	require.Equal(t, "1", first.Resources.CPURequests)
+	require.Equal(t, "1Gi", first.Resources.MemoryLimits)
+	require.Equal(t, "Guaranteed", first.QOSClass)
+	require.Equal(t, &ownerRef{Kind: "ReplicaSet", Name: "test-identity-client-84d67bb5c7"}, first.Owner)
+	require.Equal(t, "BestEffort", out.Items[1].Derived.QOSClass)
+}
+
+func TestComputeAllocations(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/pod-list.json")
+	require.Nil(t, err)
+
+	allocs, err := computeAllocations(bytes.NewReader(b))
+	require.Nil(t, err)
+	a := allocs["ip-10-200-133-84.us-west-2.compute.internal"]
+	require.NotNil(t, a)
+	require.Equal(t, 1, a.pods)
+	require.Equal(t, "1", a.cpuRequests.String())
+	require.Equal(t, 2, allocs["ip-10-200-151-23.us-west-2.compute.internal"].pods)
+}
+
+func TestDeclarativeProjection(t *testing.T) {
+	ps, err := loadProjections([]string{"testdata/projections.yaml"})
+	require.Nil(t, err)
+	require.NotNil(t, ps["/:Pod"])
+
+	var out struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Derived map[string]string `json:"derived"`
+		} `json:"items"`
+	}
+	err = json.Unmarshal(filterPodList(t, projections.merge(ps), "/:Pod", nil), &out)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(out.Items))
+	require.Equal(t, "test-identity-client-84d67bb5c7-55z9q", out.Items[0].Metadata.Name)
+	require.Equal(t, "ip-10-200-133-84.us-west-2.compute.internal", out.Items[0].Derived["node"])
+	require.Equal(t, "images/test-identity-client:0.1-20180625-060503", out.Items[0].Derived["image"])
+	require.Equal(t, "", out.Items[0].Derived["missing"])
+}
+
+func TestDeclarativeProjectionErrors(t *testing.T) {
+	_, err := ProjectionsFile{Projections: []ProjectionConfig{{Columns: []ColumnConfig{{Name: "x", JSONPath: "a"}}}}}.toProjectionSet()
+	require.NotNil(t, err)
+	_, err = ProjectionsFile{Projections: []ProjectionConfig{{Kind: "v1:Pod", Columns: []ColumnConfig{{Name: "x", JSONPath: "{.a"}}}}}.toProjectionSet()
+	require.NotNil(t, err)
+}
+
+func TestFieldsProjection(t *testing.T) {
+	require.Equal(t, []string{"metadata.name", "{.spec.containers[*]['name','image']}", "status.phase"},
+		splitFields("metadata.name, {.spec.containers[*]['name','image']},status.phase,"))
+
+	_, err := newFieldsProjection([]string{" , "})
+	require.NotNil(t, err)
+
+	fp, err := newFieldsProjection([]string{"metadata.name,spec.nodeName", "{.spec.containers[*].name}", "spec.nope"})
+	require.Nil(t, err)
+
+	var out struct {
+		Items []map[string]interface{} `json:"items"`
+	}
+	err = json.Unmarshal(filterPodList(t, projectionSet{"": fp}, "/:Pod", nil), &out)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(out.Items))
+	require.Equal(t, "test-identity-client-84d67bb5c7-55z9q", out.Items[0]["metadata.name"])
+	require.Equal(t, "ip-10-200-133-84.us-west-2.compute.internal", out.Items[0]["spec.nodeName"])
+	require.Equal(t, "main", out.Items[0]["{.spec.containers[*].name}"])
+	require.Equal(t, 2, len(out.Items[1]["{.spec.containers[*].name}"].([]interface{})))
+	require.Nil(t, out.Items[0]["spec.nope"])
+	_, ok := out.Items[0]["spec.nope"]
+	require.True(t, ok)
+}
+
+func TestFilterAndSort(t *testing.T) {
+	names := func(filters, sorts []string) []string {
+		q, err := parseListQuery(filters, sorts)
+		require.Nil(t, err)
+		var out struct {
+			Items []outPod `json:"items"`
+		}
+		err = json.Unmarshal(filterPodList(t, projections, "/:Pod", q), &out)
+		require.Nil(t, err)
+		var ret []string
+		for _, item := range out.Items {
+			ret = append(ret, item.Metadata.Name)
+		}
+		return ret
+	}
+
+	all := names(nil, nil)
+	require.Equal(t, 3, len(all))
+	require.Equal(t, []string{all[0]}, names([]string{"Guaranteed"}, nil))
+	require.Equal(t, []string{all[0]}, names([]string{"derived.qosClass:/^Guar/"}, nil))
+	require.Equal(t, []string{all[0]}, names([]string{"labels.app:test-identity-client"}, nil))
+	require.Equal(t, 0, len(names([]string{"name:nope"}, nil)))
+	require.Equal(t, []string{all[2], all[1], all[0]}, names(nil, []string{"-name"}))
+	require.Equal(t, []string{all[0], all[2], all[1]}, names(nil, []string{"nodeName,-name"}))
+
+	_, err := parseListQuery([]string{"/[/"}, nil)
+	require.NotNil(t, err)
+	q, err := parseListQuery([]string{""}, []string{" , "})
+	require.Nil(t, err)
+	require.Nil(t, q)
+}
+
+func TestCompareValues(t *testing.T) {
+	require.Equal(t, -1, compareValues("2", "10"))
+	require.Equal(t, -1, compareValues("500m", "2"))
+	require.Equal(t, 1, compareValues("1Gi", "512Mi"))
+	require.Equal(t, 0, compareValues("1024Mi", "1Gi"))
+	require.Equal(t, -1, compareValues("Ready", "Unknown"))
+}
+
+func TestProjectionTruncated(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/pod-list.json")
+	require.Nil(t, err)
+
+	for _, n := range []int{10, len(b) / 2, len(b) - 10} {
+		var w bytes.Buffer
+		df := newFilter(bytes.NewReader(b[:n]), &w, "/:Pod")
+		err = df.process()
+		require.NotNil(t, err)
+		var out struct {
+			Items []outPod  `json:"items"`
+			Error *APIError `json:"error"`
+		}
+		err = json.Unmarshal(w.Bytes(), &out)
+		require.Nil(t, err, w.String())
+		require.True(t, len(out.Items) < 3)
+		require.NotNil(t, out.Error)
+		require.Equal(t, reasonStreamError, out.Error.Reason)
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import "sync"
+
+// maxRecentNamespaces is the number of namespaces remembered for every context.
+const maxRecentNamespaces = 5
+
+// recentNamespaces tracks the namespaces most recently listed for every context.
+type recentNamespaces struct {
+	l sync.Mutex
+	m map[string][]string
+}
+
+// newRecentNamespaces returns an empty namespace tracker.
+func newRecentNamespaces() *recentNamespaces {
+	return &recentNamespaces{m: map[string][]string{}}
+}
+
+// add moves the namespace to the front of the list for the context.
+func (r *recentNamespaces) add(ctx, ns string) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	list := []string{ns}
+	for _, n := range r.m[ctx] {
+		if n != ns && len(list) < maxRecentNamespaces {
+			list = append(list, n)
+		}
+	}
+	r.m[ctx] = list
+}
+
+// get returns a copy of the recent namespaces for the context, latest first.
+func (r *recentNamespaces) get(ctx string) []string {
+	r.l.Lock()
+	defer r.l.Unlock()
+	return append([]string(nil), r.m[ctx]...)
+}
@@ -0,0 +1,18 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecentNamespaces(t *testing.T) {
+	r := newRecentNamespaces()
+	require.Equal(t, 0, len(r.get("dev")))
+	for _, ns := range []string{"a", "b", "c", "a", "d", "e", "f"} {
+		r.add("dev", ns)
+	}
+	r.add("prod", "x")
+	require.Equal(t, []string{"f", "e", "d", "a", "c"}, r.get("dev"))
+	require.Equal(t, []string{"x"}, r.get("prod"))
+}
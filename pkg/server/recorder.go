@@ -0,0 +1,234 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// fixtureHeaders are the request headers that are recorded and distinguish fixtures,
+// in addition to impersonation headers. Credentials are never recorded.
+var fixtureHeaders = []string{k8sImpersonateUser, k8sImpersonateUID, k8sImpersonateGroup}
+
+// fixtureBody is a JSON body, stored as is, or any other body stored as text.
+type fixtureBody struct {
+	Body json.RawMessage `json:"body,omitempty"`
+	Text string          `json:"text,omitempty"`
+}
+
+func newFixtureBody(b []byte) fixtureBody {
+	if len(b) > 0 && json.Valid(b) {
+		return fixtureBody{Body: json.RawMessage(b)}
+	}
+	return fixtureBody{Text: string(b)}
+}
+
+func (f fixtureBody) bytes() []byte {
+	if f.Body != nil {
+		return f.Body
+	}
+	return []byte(f.Text)
+}
+
+// fixtureRequest is a recorded Kubernetes API request.
+type fixtureRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"` // the path and query
+	Header http.Header `json:"header,omitempty"`
+	fixtureBody
+}
+
+// fixtureResponse is a recorded Kubernetes API response.
+type fixtureResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	fixtureBody
+}
+
+// fixture is a request/response pair saved as a file.
+type fixture struct {
+	Request  fixtureRequest  `json:"request"`
+	Response fixtureResponse `json:"response"`
+}
+
+// recordedHeader returns the request headers that are recorded.
+func recordedHeader(h http.Header) http.Header {
+	ret := http.Header{}
+	for k, v := range h {
+		if strings.HasPrefix(k, k8sImpersonateExtraPref) {
+			ret[k] = v
+		}
+	}
+	for _, k := range fixtureHeaders {
+		if v, ok := h[k]; ok {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// readBody reads and replaces the body of a request such that it can still be sent.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+// fixtureName returns the slash-separated file name of the fixture for a request.
+// The name is derived from the path and method. Requests with a query, recorded
+// headers or a body have a hash of these appended, such that, for example, access
+// reviews for different resources are saved separately.
+func fixtureName(r *http.Request, body []byte) string {
+	p := strings.Trim(path.Clean("/"+r.URL.Path), "/")
+	if p == "" {
+		p = "root"
+	}
+	name := p + "." + strings.ToLower(r.Method)
+	q := r.URL.Query().Encode()
+	h := recordedHeader(r.Header)
+	if q == "" && len(h) == 0 && len(body) == 0 {
+		return name + ".json"
+	}
+	var keys []string
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s\n", q)
+	for _, k := range keys {
+		fmt.Fprintf(sum, "%s: %s\n", k, strings.Join(h[k], ","))
+	}
+	sum.Write(body)
+	return name + "." + hex.EncodeToString(sum.Sum(nil))[:12] + ".json"
+}
+
+// recordingTransport saves the requests made with a delegate and their responses
+// to fixture files in a directory, overwriting earlier recordings of the same request.
+// It is installed below the authentication of the Kubernetes client such that it sees
+// impersonation headers added by hdrTransport, but does not record credentials.
+type recordingTransport struct {
+	dir      string
+	delegate http.RoundTripper
+	l        sync.Mutex
+}
+
+// RoundTrip implements the round tripper.
+func (t *recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.delegate.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	f := fixture{
+		Request: fixtureRequest{
+			Method:      r.Method,
+			URL:         r.URL.RequestURI(),
+			fixtureBody: newFixtureBody(reqBody),
+		},
+		Response: fixtureResponse{
+			Status:      resp.StatusCode,
+			fixtureBody: newFixtureBody(b),
+		},
+	}
+	if h := recordedHeader(r.Header); len(h) > 0 {
+		f.Request.Header = h
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		f.Response.Header = http.Header{"Content-Type": {ct}}
+	}
+	if err := t.save(fixtureName(r, reqBody), f); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *recordingTransport) save(name string, f fixture) error {
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(t.dir, filepath.FromSlash(name))
+	t.l.Lock()
+	defer t.l.Unlock()
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(b, '\n'), 0600)
+}
+
+// CloseIdleConnections closes the idle connections of the delegate, if supported.
+func (t *recordingTransport) CloseIdleConnections() {
+	if ci, ok := t.delegate.(interface{ CloseIdleConnections() }); ok {
+		ci.CloseIdleConnections()
+	}
+}
+
+// replayTransport serves requests from the fixture files saved by a recordingTransport.
+// Requests without a fixture fail, such that tests notice missing recordings.
+type replayTransport struct {
+	dir string
+}
+
+// RoundTrip implements the round tripper.
+func (t *replayTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	name := fixtureName(r, reqBody)
+	b, err := ioutil.ReadFile(filepath.Join(t.dir, filepath.FromSlash(name)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no recording for %s %s (%s)", r.Method, r.URL.RequestURI(), name)
+		}
+		return nil, err
+	}
+	var f fixture
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("parse recording %s, %v", name, err)
+	}
+	body := f.Response.bytes()
+	header := http.Header{}
+	for k, v := range f.Response.Header {
+		header[k] = v
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Response.Status, http.StatusText(f.Response.Status)),
+		StatusCode:    f.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}, nil
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixtureName(t *testing.T) {
+	r := httptest.NewRequest("GET", "https://k8s.example.com/api/v1/namespaces/default/pods", nil)
+	require.Equal(t, "api/v1/namespaces/default/pods.get.json", fixtureName(r, nil))
+
+	r = httptest.NewRequest("GET", "https://k8s.example.com/", nil)
+	require.Equal(t, "root.get.json", fixtureName(r, nil))
+
+	r = httptest.NewRequest("GET", "https://k8s.example.com/api/v1/pods?b=2&a=1", nil)
+	name := fixtureName(r, nil)
+	require.True(t, strings.HasPrefix(name, "api/v1/pods.get."), name)
+	r = httptest.NewRequest("GET", "https://k8s.example.com/api/v1/pods?a=1&b=2", nil)
+	require.Equal(t, name, fixtureName(r, nil))
+
+	r.Header.Set(k8sImpersonateUser, "jane")
+	require.NotEqual(t, name, fixtureName(r, nil))
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set("User-Agent", "kui")
+	impersonated := fixtureName(r, nil)
+	r.Header.Del("Authorization")
+	require.Equal(t, impersonated, fixtureName(r, nil))
+
+	r = httptest.NewRequest("POST", "https://k8s.example.com/apis/authorization.k8s.io/v1/selfsubjectaccessreviews", nil)
+	require.NotEqual(t, fixtureName(r, []byte(`{"a":1}`)), fixtureName(r, []byte(`{"a":2}`)))
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/version":
+			w.Write([]byte("not json"))
+		case r.Header.Get(k8sImpersonateUser) != "":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(403)
+			w.Write([]byte(`{"kind":"Status","code":403}`))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"kind":"PodList","items":[]}`))
+		}
+	}))
+	defer upstream.Close()
+
+	dir, err := ioutil.TempDir("", "kui-recorder")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	do := func(rt http.RoundTripper, path string, imp Impersonation) (int, string, error) {
+		req, err := http.NewRequest("GET", upstream.URL+path, nil)
+		require.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := (&http.Client{Transport: &hdrTransport{impersonation: imp, delegate: rt}}).Do(req)
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		require.Nil(t, err)
+		return resp.StatusCode, string(b), nil
+	}
+
+	rec := &recordingTransport{dir: dir, delegate: http.DefaultTransport}
+	jane := Impersonation{User: "jane"}
+	for _, imp := range []Impersonation{{}, jane} {
+		_, _, err := do(rec, "/api/v1/pods?limit=10", imp)
+		require.Nil(t, err)
+	}
+	_, _, err = do(rec, "/version", Impersonation{})
+	require.Nil(t, err)
+
+	var files []string
+	err = filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			b, err := ioutil.ReadFile(p)
+			require.Nil(t, err)
+			require.NotContains(t, string(b), "secret")
+			files = append(files, p)
+		}
+		return err
+	})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(files))
+
+	rep := &replayTransport{dir: dir}
+	code, body, err := do(rep, "/api/v1/pods?limit=10", Impersonation{})
+	require.Nil(t, err)
+	require.Equal(t, 200, code)
+	require.Contains(t, body, `"PodList"`)
+	code, body, err = do(rep, "/api/v1/pods?limit=10", jane)
+	require.Nil(t, err)
+	require.Equal(t, 403, code)
+	require.Contains(t, body, `"Status"`)
+	code, body, err = do(rep, "/version", Impersonation{})
+	require.Nil(t, err)
+	require.Equal(t, "not json", body)
+
+	_, _, err = do(rep, "/api/v1/pods?limit=20", Impersonation{})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "no recording for GET /api/v1/pods?limit=20")
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+
+	"github.com/dimfeld/httptreemux"
+	"github.com/pkg/errors"
+)
+
+const (
+	secretType       = "/:Secret"
+	configMapType    = "/:ConfigMap"
+	redactedValue    = "<redacted>"
+	keyQueryParam    = "key"
+	lastAppliedAnnot = "kubectl.kubernetes.io/last-applied-configuration"
+)
+
+// redactor masks sensitive values in secrets and, optionally, config maps.
+type redactor struct {
+	disabled      bool
+	configMapKeys []*regexp.Regexp
+}
+
+// newRedactor returns a redactor that masks secret data and config map keys
+// matching any of the supplied regular expressions.
+func newRedactor(disabled bool, configMapKeyPatterns []string) (*redactor, error) {
+	rd := &redactor{disabled: disabled}
+	for _, p := range configMapKeyPatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "config map key pattern %s", p)
+		}
+		rd.configMapKeys = append(rd.configMapKeys, re)
+	}
+	return rd, nil
+}
+
+// applies returns true if objects of the supplied type need redaction.
+func (rd *redactor) applies(objType string) bool {
+	if rd.disabled {
+		return false
+	}
+	return objType == secretType || (objType == configMapType && len(rd.configMapKeys) > 0)
+}
+
+func (rd *redactor) isRedactedConfigMapKey(key string) bool {
+	for _, re := range rd.configMapKeys {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactObject masks sensitive values of a single object in place.
+func (rd *redactor) redactObject(obj map[string]interface{}, objType string) {
+	maskKeys := func(field string, match func(string) bool) bool {
+		data, ok := obj[field].(map[string]interface{})
+		if !ok {
+			return false
+		}
+		var masked bool
+		for k := range data {
+			if match(k) {
+				data[k] = redactedValue
+				masked = true
+			}
+		}
+		return masked
+	}
+	var masked bool
+	switch objType {
+	case secretType:
+		all := func(string) bool { return true }
+		masked = maskKeys("data", all)
+		masked = maskKeys("stringData", all) || masked
+	case configMapType:
+		masked = maskKeys("data", rd.isRedactedConfigMapKey)
+		masked = maskKeys("binaryData", rd.isRedactedConfigMapKey) || masked
+	}
+	// the last applied configuration has a full copy of the data
+	if !masked {
+		return
+	}
+	if md, ok := obj["metadata"].(map[string]interface{}); ok {
+		if annotations, ok := md["annotations"].(map[string]interface{}); ok {
+			if _, ok := annotations[lastAppliedAnnot]; ok {
+				annotations[lastAppliedAnnot] = redactedValue
+			}
+		}
+	}
+}
+
+// redact reads an object, a list of objects or a single watch event of the supplied
+// type and returns its JSON representation with sensitive values masked. Anything
+// following the first JSON value, such as further watch events, is an error.
+func (rd *redactor) redact(r io.Reader, objType string) ([]byte, error) {
+	var obj map[string]interface{}
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		return nil, errors.Wrap(err, "decode for redaction")
+	}
+	if dec.More() {
+		return nil, errors.New("decode for redaction: unexpected data after object")
+	}
+	if items, ok := obj["items"].([]interface{}); ok {
+		for _, item := range items {
+			if m, ok := item.(map[string]interface{}); ok {
+				rd.redactObject(m, objType)
+			}
+		}
+	} else if event, ok := obj["object"].(map[string]interface{}); ok {
+		rd.redactObject(event, objType)
+	} else {
+		rd.redactObject(obj, objType)
+	}
+	return json.Marshal(obj)
+}
+
+// RevealedValue is a single revealed key of a secret or config map.
+type RevealedValue struct {
+	Key   string `json:"key"`   // the data key
+	Value string `json:"value"` // the decoded value
+}
+
+// revealValue returns a single decoded value of a secret or config map and records
+// the access in the audit log.
+func (s *server) revealValue(w http.ResponseWriter, r *http.Request) {
+	p := httptreemux.ContextParams(r.Context())
+	cfg, err := s.getConfig()
+	if err != nil {
+		writeError(w, 500, reasonConfigError, err)
+		return
+	}
+
+	r.ParseForm()
+
+	ctx := p[contextParamName]
+	id := p[resourceIDParamName]
+	ns := r.Form.Get(namespaceQueryParam)
+	key := r.Form.Get(keyQueryParam)
+	if key == "" {
+		writeErrorMessage(w, 400, reasonBadRequest, "no key specified")
+		return
+	}
+
+	ri, err := s.getResourceInfo(cfg, ctx, r.Form.Get(resourceQueryParam))
+	if err != nil {
+		writeResourceInfoError(w, err)
+		return
+	}
+	objType := ri.Key.WithEmptyVersion().String()
+	if objType != secretType && objType != configMapType {
+		writeErrorMessage(w, 400, reasonBadRequest, "values can only be revealed for secrets and config maps")
+		return
+	}
+
+	imp, err := s.impersonationFor(r, ctx)
+	if err != nil {
+		writeErrorMessage(w, 400, reasonBadRequest, "invalid impersonation: "+err.Error())
+		return
+	}
+	conn, err := s.getConn(cfg, ctx, imp)
+	if err != nil {
+		writeError(w, 500, reasonConnectionError, err)
+		return
+	}
+
+	reqCtx := withLogAttrs(r.Context(), "resource", ri.Key.String())
+	requestLogger(reqCtx).Info("audit: reveal", "namespace", ns, "name", id, "key", key, "as", imp.User, "remote", r.RemoteAddr)
+
+	resp, err := conn.get(reqCtx, conn.baseURL+ri.APIListPath(ns)+"/"+id)
+	if err != nil {
+		writeError(w, 502, reasonConnectionError, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		writeAPIError(w, statusFromResponse(resp.StatusCode, resp.Body))
+		return
+	}
+
+	var obj struct {
+		Data       map[string]string `json:"data"`
+		StringData map[string]string `json:"stringData"`
+		BinaryData map[string]string `json:"binaryData"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		writeError(w, 500, reasonInternalError, err)
+		return
+	}
+
+	value, found := obj.Data[key]
+	encoded := objType == secretType
+	if !found {
+		if value, found = obj.StringData[key]; found {
+			encoded = false
+		} else if value, found = obj.BinaryData[key]; found {
+			encoded = true
+		}
+	}
+	if !found {
+		writeErrorMessage(w, 404, reasonNotFound, fmt.Sprintf("key %s not found", key))
+		return
+	}
+	if encoded {
+		b, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			writeError(w, 500, reasonInternalError, err)
+			return
+		}
+		value = string(b)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	enc := json.NewEncoder(w)
+	enc.Encode(RevealedValue{Key: key, Value: value})
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactSecret(t *testing.T) {
+	rd, err := newRedactor(false, nil)
+	require.Nil(t, err)
+	require.True(t, rd.applies(secretType))
+	require.False(t, rd.applies(configMapType))
+
+	in := `{"kind":"Secret","metadata":{"name":"foo","generation":12345678901,
+"annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{\"data\":{\"password\":\"c2VjcmV0\"}}"}},
+"data":{"password":"c2VjcmV0"}}`
+	b, err := rd.redact(strings.NewReader(in), secretType)
+	require.Nil(t, err)
+	require.NotContains(t, string(b), "c2VjcmV0")
+	require.Contains(t, string(b), "12345678901")
+
+	var out struct {
+		Data map[string]string `json:"data"`
+	}
+	require.Nil(t, json.Unmarshal(b, &out))
+	require.Equal(t, redactedValue, out.Data["password"])
+}
+
+func TestRedactWatchEvent(t *testing.T) {
+	rd, err := newRedactor(false, nil)
+	require.Nil(t, err)
+
+	in := `{"type":"ADDED","object":{"kind":"Secret","metadata":{"name":"foo"},"data":{"password":"c2VjcmV0"}}}`
+	b, err := rd.redact(strings.NewReader(in), secretType)
+	require.Nil(t, err)
+	require.NotContains(t, string(b), "c2VjcmV0")
+	require.Contains(t, string(b), `"type":"ADDED"`)
+
+	_, err = rd.redact(strings.NewReader(in+"\n"+in), secretType)
+	require.NotNil(t, err)
+}
+
+func TestRedactConfigMapList(t *testing.T) {
+	rd, err := newRedactor(false, []string{"(?i)token$"})
+	require.Nil(t, err)
+	require.True(t, rd.applies(configMapType))
+
+	in := `{"kind":"ConfigMapList","items":[{"metadata":{"name":"a"},"data":{"apiToken":"xyz","color":"blue"}}]}`
+	b, err := rd.redact(strings.NewReader(in), configMapType)
+	require.Nil(t, err)
+	require.NotContains(t, string(b), "xyz")
+	require.Contains(t, string(b), "blue")
+
+	_, err = newRedactor(false, []string{"("})
+	require.NotNil(t, err)
+
+	rd, err = newRedactor(true, nil)
+	require.Nil(t, err)
+	require.False(t, rd.applies(secretType))
+}
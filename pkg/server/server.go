@@ -1,12 +1,16 @@
 package server
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
+	"mime"
 	"net/http"
+	"net/http/pprof"
 	"net/url"
 	"os"
 	"os/user"
@@ -19,7 +23,7 @@ import (
 	"github.com/dimfeld/httptreemux"
 	"github.com/gotwarlost/kui/pkg/kubeconfig"
 	"github.com/gotwarlost/kui/pkg/registry"
-	"github.com/mash/go-accesslog"
+	"github.com/gotwarlost/kui/pkg/snapshot"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/rest"
 )
@@ -29,29 +33,52 @@ const (
 	resourceIDParamName = "id"
 	resourceQueryParam  = "res"
 	namespaceQueryParam = "namespace"
+	allocatedQueryParam = "allocated"
+	fieldsQueryParam    = "fields"
+	formatQueryParam    = "format"
+	filterQueryParam    = "filter"
+	sortQueryParam      = "sort"
 )
 
 // Impersonation provides a mechanism to impersonate other users and
-// groups when making calls to the Kubernetes API. This is applied for _all_
-// contexts and may only be meaningfully used when the user is a cluster
-// admin for all contexts.
+// groups when making calls to the Kubernetes API. The impersonation in the
+// server config is the default for all contexts. It may be overridden for a
+// context and for a single request using headers or query parameters.
 type Impersonation struct {
-	User   string   // user to impersonate
-	Groups []string // groups to impersonate
+	User   string              // user to impersonate
+	UID    string              // uid to impersonate
+	Groups []string            // groups to impersonate
+	Extra  map[string][]string // extra values to impersonate, keyed by name
 }
 
 // Config is the server config.
 type Config struct {
-	StaticRoot      string        // the root of the filesystem for the static server
-	KubeConfigFiles []string      // list of kubeconfig files, empty uses k8s defaults
-	Impersonation   Impersonation // any client impersonation required
-	UserAgent       string        // the user-agent to use
+	StaticRoot           string                   // the root of the filesystem for the static server
+	Assets               http.FileSystem          // the static assets, overrides StaticRoot when set
+	KubeConfigFiles      []string                 // list of kubeconfig files, empty uses k8s defaults
+	Impersonation        Impersonation            // any client impersonation required
+	ContextImpersonation map[string]Impersonation // impersonation for specific contexts, overriding the default
+	UserAgent            string                   // the user-agent to use
+	ProjectionFiles      []string                 // YAML files with declarative projections, merged with the built-in ones
+	NoRedaction          bool                     // do not redact secret data
+	RedactConfigMapKeys  []string                 // regular expressions for config map keys to redact
+	Token                string                   // the per-launch token required for all requests, empty disables authentication
+	SettingsFile         string                   // the user settings file edited through the API, empty disables the settings API
+	Pprof                bool                     // serve runtime profiles under /debug/pprof/
+	Snapshot             string                   // a snapshot directory or tarball served instead of the clusters in the kubeconfig
+	Record               string                   // a directory where Kubernetes API requests and responses are saved as fixtures
+	Replay               string                   // a directory of recorded fixtures served instead of the clusters in the kubeconfig
 }
 
 // APIHandler is an HTTP handler with some additional methods.
 type APIHandler interface {
 	http.Handler
-	BustCache() // bust all internal caches
+	BustCache()                           // bust all internal caches
+	ContextNames() ([]string, error)      // the contexts in the current kubeconfig
+	RecentNamespaces(ctx string) []string // the namespaces most recently used for a context, latest first
+	Close()                               // release idle connections to all clusters
+	// Export exports a context, or a namespace in it, to a snapshot. The caller closes the writer.
+	Export(reqCtx context.Context, ctx string, opts ExportOptions, sw *snapshot.Writer) error
 }
 
 // conn is connection information for a specific context that includes
@@ -59,6 +86,19 @@ type APIHandler interface {
 type conn struct {
 	baseURL string
 	client  *http.Client
+	rt      http.RoundTripper // the transport without impersonation
+}
+
+// as returns a connection that makes requests with the supplied impersonation.
+func (c *conn) as(imp Impersonation) *conn {
+	if imp.isEmpty() {
+		return c
+	}
+	return &conn{
+		baseURL: c.baseURL,
+		client:  &http.Client{Transport: &hdrTransport{impersonation: imp, delegate: c.rt}},
+		rt:      c.rt,
+	}
 }
 
 // fileWithStats tracks a file and its associated stat object, if found.
@@ -80,27 +120,36 @@ func (it *hdrTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 	if it.ua != "" {
 		r.Header.Set("User-Agent", it.ua)
 	}
-	imp := it.impersonation
-	if imp.User != "" {
-		r.Header.Set("Impersonate-User", imp.User)
-	}
-	for _, g := range imp.Groups {
-		if g != "" {
-			r.Header.Add("Impersonate-Group", g)
-		}
-	}
+	it.impersonation.setHeaders(r.Header)
 	return it.delegate.RoundTrip(r)
 }
 
+// CloseIdleConnections closes the idle connections of the delegate, if supported.
+func (it *hdrTransport) CloseIdleConnections() {
+	if ci, ok := it.delegate.(interface{ CloseIdleConnections() }); ok {
+		ci.CloseIdleConnections()
+	}
+}
+
 // server implements APIHandler
 type server struct {
-	ua            string
-	impersonation Impersonation
-	kcFiles       []fileWithStats
-	l             sync.RWMutex
-	cfg           *kubeconfig.Config
-	regMap        map[string]*registry.ResourceRegistry
-	connMap       map[string]*conn
+	ua                   string
+	impersonation        Impersonation
+	contextImpersonation map[string]Impersonation
+	kcFiles              []fileWithStats
+	l                    sync.RWMutex
+	cfg                  *kubeconfig.Config
+	regMap               map[string]cachedRegistry
+	connMap              map[string]*conn
+	projections          projectionSet
+	redactor             *redactor
+	recent               *recentNamespaces
+	settingsFile         string
+	settingsLock         sync.Mutex
+	metrics              *serverMetrics
+	snapshot             *snapshot.Snapshot
+	recordDir            string
+	replayDir            string
 }
 
 type handler struct {
@@ -108,17 +157,6 @@ type handler struct {
 	*server
 }
 
-var lg = log.New(os.Stderr, "[accesslog] ", 0)
-
-type logger struct {
-}
-
-func (l *logger) Log(rec accesslog.LogRecord) {
-	if rec.Status < 200 && rec.Status >= 400 {
-		lg.Printf("(%d, %15v) %s %s", rec.Status, rec.ElapsedTime, rec.Method, rec.Uri)
-	}
-}
-
 // getDefaultKubeConfigFiles returns the default kubeconfig files typically derived
 // by Kubernetes (from KUBECONFIG and ~/.kube/config).
 func getDefaultKubeConfigFiles() []string {
@@ -129,7 +167,7 @@ func getDefaultKubeConfigFiles() []string {
 	var homeDir string
 	u, err := user.Current()
 	if err != nil {
-		log.Printf("error getting current user, using $HOME, %v\n", err)
+		slog.Warn("error getting current user, using $HOME", "error", err)
 		homeDir = os.Getenv("HOME")
 	} else {
 		homeDir = u.HomeDir
@@ -140,49 +178,131 @@ func getDefaultKubeConfigFiles() []string {
 	return nil
 }
 
+// KubeConfigFiles returns the supplied kubeconfig files or, if there are none, the
+// files in $KUBECONFIG or the default kubeconfig file in the home directory.
+func KubeConfigFiles(files []string) []string {
+	if len(files) > 0 {
+		return files
+	}
+	return getDefaultKubeConfigFiles()
+}
+
 // New returns an API handler for the supplied configuration.
 func New(c Config) (APIHandler, error) {
 	files := c.KubeConfigFiles
 	staticRoot := c.StaticRoot
 
-	if len(files) == 0 {
-		files = getDefaultKubeConfigFiles()
+	if c.Replay != "" && (c.Snapshot != "" || c.Record != "") {
+		return nil, fmt.Errorf("replay cannot be used with a snapshot or recording")
+	}
+	var snap *snapshot.Snapshot
+	if c.Snapshot != "" {
+		var err error
+		snap, err = snapshot.Open(c.Snapshot)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open snapshot, %v", err)
+		}
+		files = nil
+	} else {
+		files = KubeConfigFiles(files)
 	}
 	var fs []fileWithStats
 	for _, f := range files {
 		fws := fileWithStats{file: f}
 		s, err := os.Stat(f)
 		if err != nil {
-			log.Println("[warn] stat error on kubeconfig file", f)
+			slog.Warn("stat error on kubeconfig file", "file", f, "error", err)
 		} else {
 			fws.stat = s
 		}
 		fs = append(fs, fws)
 	}
-	s := &server{
-		ua:            c.UserAgent,
-		impersonation: c.Impersonation,
-		kcFiles:       fs,
-		regMap:        map[string]*registry.ResourceRegistry{},
-		connMap:       map[string]*conn{},
+	if err := c.Impersonation.validate(); err != nil {
+		return nil, err
+	}
+	for ctx, imp := range c.ContextImpersonation {
+		if err := imp.validate(); err != nil {
+			return nil, fmt.Errorf("context %s: %v", ctx, err)
+		}
 	}
-	b, err := ioutil.ReadFile(filepath.Join(staticRoot, "index.html"))
+	custom, err := loadProjections(c.ProjectionFiles)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read index.html under %s", staticRoot)
+		return nil, err
+	}
+	rd, err := newRedactor(c.NoRedaction, c.RedactConfigMapKeys)
+	if err != nil {
+		return nil, err
+	}
+	s := &server{
+		ua:                   c.UserAgent,
+		impersonation:        c.Impersonation,
+		contextImpersonation: c.ContextImpersonation,
+		kcFiles:              fs,
+		regMap:               map[string]cachedRegistry{},
+		connMap:              map[string]*conn{},
+		projections:          projections.merge(custom),
+		redactor:             rd,
+		recent:               newRecentNamespaces(),
+		settingsFile:         c.SettingsFile,
+		metrics:              newServerMetrics(),
+		snapshot:             snap,
+		recordDir:            c.Record,
+		replayDir:            c.Replay,
+	}
+	assets := c.Assets
+	if assets == nil {
+		assets = http.Dir(staticRoot)
+	}
+	b, err := readAsset(assets, "/index.html")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read index.html, %v", err)
 	}
 
 	mux := httptreemux.NewContextMux()
-	mux.GET("/api/contexts", s.listContexts)
-	mux.GET(fmt.Sprintf("/api/contexts/:%s", contextParamName), s.getContext)
-	mux.GET(fmt.Sprintf("/api/contexts/:%s/resources", contextParamName), s.listResources)
-	mux.GET(fmt.Sprintf("/api/contexts/:%s/resources/:%s", contextParamName, resourceIDParamName), s.getResource)
-	mux.GET("/ui/*", func(w http.ResponseWriter, r *http.Request) {
+	get := func(route string, h http.HandlerFunc) {
+		mux.GET(route, s.metrics.instrument(route, withContextLogAttr(h)))
+	}
+	get("/api/contexts", s.listContexts)
+	get("/api/settings", s.getSettings)
+	mux.PUT("/api/settings", s.metrics.instrument("/api/settings", s.putSettings))
+	get(fmt.Sprintf("/api/contexts/:%s", contextParamName), s.getContext)
+	get(fmt.Sprintf("/api/contexts/:%s/resources", contextParamName), s.listResources)
+	get(fmt.Sprintf("/api/contexts/:%s/resources/:%s", contextParamName, resourceIDParamName), s.getResource)
+	get(fmt.Sprintf("/api/contexts/:%s/reveal/:%s", contextParamName, resourceIDParamName), s.revealValue)
+	get(fmt.Sprintf("/api/contexts/:%s/graph/:%s", contextParamName, resourceIDParamName), s.getGraph)
+	get(fmt.Sprintf("/api/contexts/:%s/usages/:%s", contextParamName, resourceIDParamName), s.getUsages)
+	get(fmt.Sprintf("/api/contexts/:%s/permissions", contextParamName), s.getPermissions)
+	get(fmt.Sprintf("/api/contexts/:%s/export", contextParamName), s.exportSnapshot)
+	get("/open/*link", s.openLink)
+	get("/ui/*", func(w http.ResponseWriter, r *http.Request) {
 		w.Write(b)
 	})
-	mux.NotFoundHandler = http.FileServer(http.Dir(staticRoot)).ServeHTTP
+	mux.GET("/debug/metrics", s.getMetrics)
+	if c.Pprof {
+		mux.GET("/debug/pprof/*", pprof.Index)
+		mux.GET("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.GET("/debug/pprof/profile", pprof.Profile)
+		mux.GET("/debug/pprof/symbol", pprof.Symbol)
+		mux.POST("/debug/pprof/symbol", pprof.Symbol)
+		mux.GET("/debug/pprof/trace", pprof.Trace)
+	}
+	mux.NotFoundHandler = s.metrics.instrument("static", http.FileServer(assets).ServeHTTP)
+
+	var root http.Handler = mux
+	if c.Token != "" {
+		root = &authenticator{token: c.Token, delegate: mux}
+	}
+	return &handler{Handler: &requestLogHandler{delegate: root}, server: s}, nil
+}
 
-	h := accesslog.NewLoggingHandler(mux, &logger{})
-	return &handler{Handler: h, server: s}, nil
+// readAsset returns the contents of the named file in the supplied file system.
+func readAsset(fs http.FileSystem, name string) ([]byte, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
 }
 
 // BustCache busts all caches including the connection and the registry cache.
@@ -190,7 +310,20 @@ func (s *server) BustCache() {
 	s.l.Lock()
 	defer s.l.Unlock()
 	s.cfg = nil
-	s.regMap = map[string]*registry.ResourceRegistry{}
+	s.regMap = map[string]cachedRegistry{}
+	s.connMap = map[string]*conn{}
+}
+
+// Close closes the idle connections of all cached clients. It is called on shutdown
+// after in-flight requests have completed.
+func (s *server) Close() {
+	s.l.Lock()
+	defer s.l.Unlock()
+	for _, c := range s.connMap {
+		if ci, ok := c.rt.(interface{ CloseIdleConnections() }); ok {
+			ci.CloseIdleConnections()
+		}
+	}
 	s.connMap = map[string]*conn{}
 }
 
@@ -204,19 +337,49 @@ func (s *server) setCachedConfig(c *kubeconfig.Config) {
 	s.l.Lock()
 	defer s.l.Unlock()
 	s.cfg = c
+	s.regMap = map[string]cachedRegistry{}
 	s.connMap = map[string]*conn{}
 }
 
+const (
+	registryTTL        = 10 * time.Minute // how long discovery results are reused
+	registryMinRefresh = 30 * time.Second // minimum age before an unknown resource forces re-discovery
+)
+
+// cachedRegistry is a resource registry along with the time it was discovered.
+type cachedRegistry struct {
+	rr     *registry.ResourceRegistry
+	loaded time.Time
+}
+
 func (s *server) getCachedRegistry(ctx string) *registry.ResourceRegistry {
 	s.l.RLock()
 	defer s.l.RUnlock()
-	return s.regMap[ctx]
+	c, ok := s.regMap[ctx]
+	if !ok || time.Since(c.loaded) >= registryTTL {
+		return nil
+	}
+	return c.rr
 }
 
 func (s *server) setCachedRegistry(ctx string, r *registry.ResourceRegistry) {
 	s.l.Lock()
 	defer s.l.Unlock()
-	s.regMap[ctx] = r
+	s.regMap[ctx] = cachedRegistry{rr: r, loaded: time.Now()}
+}
+
+// expireRegistry drops the cached registry for the supplied context so that the next
+// lookup re-discovers resources, for example after a CRD was installed. It returns false
+// without doing anything when the registry was discovered too recently.
+func (s *server) expireRegistry(ctx string) bool {
+	s.l.Lock()
+	defer s.l.Unlock()
+	c, ok := s.regMap[ctx]
+	if !ok || time.Since(c.loaded) < registryMinRefresh {
+		return false
+	}
+	delete(s.regMap, ctx)
+	return true
 }
 
 func (s *server) getCachedConn(ctx string) *conn {
@@ -231,44 +394,100 @@ func (s *server) setCachedConn(ctx string, c *conn) {
 	s.connMap[ctx] = c
 }
 
-// getConfig returns the k8s config.
-func (s *server) getConfig() (*kubeconfig.Config, error) {
-	for _, fws := range s.kcFiles {
+// kubeConfigChanged returns true if any kubeconfig file has been created or
+// modified since it was last seen.
+func (s *server) kubeConfigChanged() bool {
+	s.l.Lock()
+	defer s.l.Unlock()
+	changed := false
+	for i, fws := range s.kcFiles {
 		st, err := os.Stat(fws.file)
 		if err != nil {
 			continue
 		}
-		if fws.stat != nil {
-			if fws.stat.ModTime().Before(st.ModTime()) {
-				s.setCachedConfig(nil)
-			}
+		if fws.stat == nil || fws.stat.ModTime().Before(st.ModTime()) {
+			changed = true
 		}
+		s.kcFiles[i].stat = st
+	}
+	return changed
+}
+
+// getConfig returns the k8s config.
+func (s *server) getConfig() (*kubeconfig.Config, error) {
+	if s.kubeConfigChanged() {
+		s.setCachedConfig(nil)
 	}
 	cc := s.getCachedConfig()
+	s.metrics.cacheLookup("config", cc != nil)
 	if cc != nil {
 		return cc, nil
 	}
-	var files []string
-	for _, fws := range s.kcFiles {
-		files = append(files, fws.file)
+	var (
+		cfg *kubeconfig.Config
+		err error
+	)
+	if s.snapshot != nil {
+		cfg = s.snapshot.KubeConfig()
+	} else {
+		var files []string
+		for _, fws := range s.kcFiles {
+			files = append(files, fws.file)
+		}
+		cfg, err = kubeconfig.New(files)
 	}
-	cfg, err := kubeconfig.New(files)
-	if err != nil {
+	if err == nil {
 		s.setCachedConfig(cfg)
 	}
 	return cfg, err
 }
 
+// restConfig returns the REST configuration for the supplied context. In snapshot
+// and replay modes, requests are served from the snapshot or recorded fixtures.
+// Requests are recorded to a directory per context when recording.
+func (s *server) restConfig(cfg *kubeconfig.Config, ctx string) (*rest.Config, error) {
+	rc, err := cfg.RESTConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.snapshot != nil {
+		rc.Transport = s.snapshot.Transport(ctx)
+	}
+	if s.replayDir != "" {
+		rc.TLSClientConfig = rest.TLSClientConfig{}
+		rc.Transport = &replayTransport{dir: filepath.Join(s.replayDir, url.PathEscape(ctx))}
+	}
+	if s.recordDir != "" {
+		dir := filepath.Join(s.recordDir, url.PathEscape(ctx))
+		wrap := rc.WrapTransport
+		rc.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+			if wrap != nil {
+				rt = wrap(rt)
+			}
+			return &recordingTransport{dir: dir, delegate: rt}
+		}
+	}
+	return rc, nil
+}
+
 func (s *server) getRegistry(cfg *kubeconfig.Config, ctx string) (*registry.ResourceRegistry, error) {
 	rr := s.getCachedRegistry(ctx)
+	s.metrics.cacheLookup("registry", rr != nil)
 	if rr != nil {
 		return rr, nil
 	}
-	rc, err := cfg.RESTConfig(ctx)
+	rc, err := s.restConfig(cfg, ctx)
 	if err != nil {
 		return nil, err
 	}
-	return registry.New(rc)
+	start := time.Now()
+	rr, err = registry.New(rc)
+	s.metrics.discoveryDuration.observe(time.Since(start).Seconds(), ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.setCachedRegistry(ctx, rr)
+	return rr, nil
 }
 
 func defaultServerURLFor(config *rest.Config) (*url.URL, string, error) {
@@ -283,12 +502,15 @@ func defaultServerURLFor(config *rest.Config) (*url.URL, string, error) {
 	return rest.DefaultServerURL(host, config.APIPath, schema.GroupVersion{}, defaultTLS)
 }
 
-func (s *server) getConn(cfg *kubeconfig.Config, ctx string) (*conn, error) {
+// getConn returns a connection to the supplied context that makes requests with
+// the supplied impersonation.
+func (s *server) getConn(cfg *kubeconfig.Config, ctx string, imp Impersonation) (*conn, error) {
 	c := s.getCachedConn(ctx)
+	s.metrics.cacheLookup("conn", c != nil)
 	if c != nil {
-		return c, nil
+		return c.as(imp), nil
 	}
-	rc, err := cfg.RESTConfig(ctx)
+	rc, err := s.restConfig(cfg, ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -299,18 +521,31 @@ func (s *server) getConn(cfg *kubeconfig.Config, ctx string) (*conn, error) {
 	}
 
 	rt = &hdrTransport{
-		ua:            s.ua,
-		impersonation: s.impersonation,
-		delegate:      rt,
+		ua:       s.ua,
+		delegate: &downstreamTransport{ctx: ctx, m: s.metrics, delegate: rt},
 	}
 
 	u, _, err := defaultServerURLFor(rc)
 	if err != nil {
 		return nil, err
 	}
-	c = &conn{client: &http.Client{Transport: rt}, baseURL: u.String()}
+	c = &conn{client: &http.Client{Transport: rt}, baseURL: u.String(), rt: rt}
 	s.setCachedConn(ctx, c)
-	return c, nil
+	return c.as(imp), nil
+}
+
+// ContextNames returns the contexts in the current kubeconfig.
+func (s *server) ContextNames() ([]string, error) {
+	cfg, err := s.getConfig()
+	if err != nil {
+		return nil, err
+	}
+	return cfg.ContextNames(), nil
+}
+
+// RecentNamespaces returns the namespaces most recently used for the supplied context.
+func (s *server) RecentNamespaces(ctx string) []string {
+	return s.recent.get(ctx)
 }
 
 func (s *server) listContexts(w http.ResponseWriter, r *http.Request) {
@@ -331,17 +566,17 @@ func (s *server) getContext(w http.ResponseWriter, r *http.Request) {
 	p := httptreemux.ContextParams(r.Context())
 	cfg, err := s.getConfig()
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeError(w, 500, reasonConfigError, err)
 		return
 	}
 	ctx := p[contextParamName]
 	if !cfg.IsValidContext(ctx) {
-		http.Error(w, "invalid context:"+ctx, 400)
+		writeErrorMessage(w, 400, reasonBadRequest, "invalid context: "+ctx)
 		return
 	}
 	rr, err := s.getRegistry(cfg, ctx)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeError(w, 500, reasonRegistryError, err)
 		return
 	}
 	var ret ContextDetail
@@ -363,25 +598,120 @@ func (s *server) getContext(w http.ResponseWriter, r *http.Request) {
 	enc.Encode(ret)
 }
 
+// registryError is returned by getResourceInfo when the registry could not be loaded.
+type registryError struct {
+	error
+}
+
 func (s *server) getResourceInfo(cfg *kubeconfig.Config, ctx string, id string) (*registry.ResourceInfo, error) {
 	rr, err := s.getRegistry(cfg, ctx)
 	if err != nil {
-		return nil, err
+		return nil, registryError{err}
 	}
 	key, err := registry.ResourceKeyFromString(id)
 	if err != nil {
 		return nil, err
 	}
-	return rr.ResourceInfo(key)
+	ri, err := rr.ResourceInfo(key)
+	if err != nil && s.expireRegistry(ctx) {
+		if rr, err = s.getRegistry(cfg, ctx); err != nil {
+			return nil, registryError{err}
+		}
+		ri, err = rr.ResourceInfo(key)
+	}
+	return ri, err
 }
 
-var downLog = log.New(os.Stderr, "[downstream] ", 0)
+// writeResourceInfoError writes the error returned by getResourceInfo.
+func writeResourceInfoError(w http.ResponseWriter, err error) {
+	if _, ok := err.(registryError); ok {
+		writeError(w, 500, reasonRegistryError, err)
+		return
+	}
+	writeError(w, 400, reasonBadRequest, err)
+}
+
+// get makes a GET request for the supplied URL that is cancelled when the supplied
+// context is done, typically because the browser disconnected.
+func (c *conn) get(reqCtx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.Do(req.WithContext(reqCtx))
+}
+
+// getJSON makes a GET request for the supplied path and decodes the JSON response.
+// Unsuccessful responses are returned as an APIError.
+func (c *conn) getJSON(reqCtx context.Context, path string, v interface{}) error {
+	resp, err := c.get(reqCtx, c.baseURL+path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return statusFromResponse(resp.StatusCode, resp.Body)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// getBytes makes a GET request for the supplied path and returns the response body.
+// Unsuccessful responses are returned as an APIError.
+func (c *conn) getBytes(reqCtx context.Context, path string) ([]byte, error) {
+	resp, err := c.get(reqCtx, c.baseURL+path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, statusFromResponse(resp.StatusCode, resp.Body)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// postJSON POSTs the supplied object as JSON to the supplied path and decodes the
+// JSON response into out. Unsuccessful responses are returned as an APIError.
+func (c *conn) postJSON(reqCtx context.Context, path string, in interface{}, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req.WithContext(reqCtx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return statusFromResponse(resp.StatusCode, resp.Body)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// getNodeAllocations lists all pods in the cluster and returns the resources
+// allocated to them keyed by node name.
+func (s *server) getNodeAllocations(reqCtx context.Context, conn *conn) (map[string]*nodeAllocation, error) {
+	u := conn.baseURL + "/api/v1/pods?fieldSelector=" + url.QueryEscape("status.phase!=Succeeded,status.phase!=Failed")
+	resp, err := conn.get(reqCtx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("list pods: status %d", resp.StatusCode)
+	}
+	return computeAllocations(resp.Body)
+}
 
 func (s *server) getOrList(w http.ResponseWriter, r *http.Request, object bool) {
 	p := httptreemux.ContextParams(r.Context())
 	cfg, err := s.getConfig()
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeError(w, 500, reasonConfigError, err)
 		return
 	}
 
@@ -393,28 +723,70 @@ func (s *server) getOrList(w http.ResponseWriter, r *http.Request, object bool)
 
 	ri, err := s.getResourceInfo(cfg, ctx, res)
 	if err != nil {
-		http.Error(w, err.Error(), 400)
+		writeResourceInfoError(w, err)
+		return
+	}
+	r = r.WithContext(withLogAttrs(r.Context(), "resource", ri.Key.String()))
+	lg := requestLogger(r.Context())
+
+	format, err := negotiateFormat(r)
+	if err == nil {
+		err = checkFormat(format, object)
+	}
+	if err != nil {
+		writeError(w, 400, reasonBadRequest, err)
 		return
 	}
 
-	conn, err := s.getConn(cfg, ctx)
+	query, err := parseListQuery(r.Form[filterQueryParam], r.Form[sortQueryParam])
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeError(w, 400, reasonBadRequest, err)
 		return
 	}
 
-	path := ri.APIListPath(r.Form.Get(namespaceQueryParam))
+	ps := s.projections
+	if fields := r.Form[fieldsQueryParam]; len(fields) > 0 && !object {
+		fp, err := newFieldsProjection(fields)
+		if err != nil {
+			writeErrorMessage(w, 400, reasonBadRequest, "invalid fields: "+err.Error())
+			return
+		}
+		ps = projectionSet{"": fp}
+	}
+
+	imp, err := s.impersonationFor(r, ctx)
+	if err != nil {
+		writeErrorMessage(w, 400, reasonBadRequest, "invalid impersonation: "+err.Error())
+		return
+	}
+	conn, err := s.getConn(cfg, ctx, imp)
+	if err != nil {
+		writeError(w, 500, reasonConnectionError, err)
+		return
+	}
+
+	ns := r.Form.Get(namespaceQueryParam)
+	if ns != "" && !ri.IsClusterResource {
+		s.recent.add(ctx, ns)
+	}
+	path := ri.APIListPath(ns)
 
 	if object {
 		path += "/" + id
 	}
 
 	u := conn.baseURL + path
+	objType := ri.Key.WithEmptyVersion().String()
 	var queryParams []string
 	prefix := "k8s."
 	for k := range r.Form {
 		if strings.Index(k, prefix) == 0 {
 			k2 := k[len(prefix):]
+			// a watch returns a stream of events that cannot be redacted
+			if k2 == "watch" && s.redactor.applies(objType) {
+				writeErrorMessage(w, 400, reasonBadRequest, "watch is not supported for redacted resources")
+				return
+			}
 			v := url.QueryEscape(r.Form.Get(k))
 			queryParams = append(queryParams, fmt.Sprintf("%s=%s", k2, v))
 		}
@@ -423,33 +795,94 @@ func (s *server) getOrList(w http.ResponseWriter, r *http.Request, object bool)
 		u = fmt.Sprintf("%s?%s", u, strings.Join(queryParams, "&"))
 	}
 
-	start := time.Now()
-	downLog.Println("GET", u)
-	resp, err := conn.client.Get(u)
+	resp, err := conn.get(r.Context(), u)
 	if err != nil {
-		downLog.Println("error: GET", u, err)
-		http.Error(w, err.Error(), 500)
+		writeError(w, 502, reasonConnectionError, err)
 		return
 	}
-	defer func() {
-		d := time.Now().Sub(start)
-		code := resp.StatusCode
-		if code < 200 || code >= 400 {
-			downLog.Printf("(%d, %15v) %s %s", code, d, "GET", u)
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		writeAPIError(w, statusFromResponse(resp.StatusCode, resp.Body))
+		return
+	}
+
+	var allocations map[string]*nodeAllocation
+	if !object && ri.Key.WithEmptyVersion().String() == "/:Node" && r.Form.Get(allocatedQueryParam) == "true" {
+		allocations, err = s.getNodeAllocations(r.Context(), conn)
+		if err != nil {
+			lg.Warn("node allocations", "error", err)
 		}
-	}()
+	}
 
-	defer resp.Body.Close()
-	w.WriteHeader(resp.StatusCode)
+	var body io.Reader = resp.Body
+	if s.redactor.applies(objType) {
+		b, err := s.redactor.redact(resp.Body, objType)
+		if err != nil {
+			writeError(w, 500, reasonInternalError, err)
+			return
+		}
+		body = bytes.NewReader(b)
+	}
+	// the headers of a download are only set once it cannot fail, such that errors
+	// are shown instead of saved
+	writeHeader := func() {
+		if format != formatJSON {
+			name := ri.APIPathName
+			if object {
+				name = id
+			}
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + "." + format}))
+		}
+		w.Header().Set("Content-Type", formatContentTypes[format])
+		w.WriteHeader(resp.StatusCode)
+	}
+
+	if object && format == formatYAML {
+		var buf bytes.Buffer
+		if err := writeYAML(body, &buf); err != nil {
+			writeError(w, 500, reasonInternalError, err)
+			return
+		}
+		writeHeader()
+		buf.WriteTo(w)
+		return
+	}
 
 	if object {
-		io.Copy(w, resp.Body)
+		writeHeader()
+		if _, err := io.Copy(w, body); err != nil {
+			lg.Error("copy", "url", u, "error", err)
+		}
+		return
+	}
+
+	newListFilter := func(out io.Writer) *dataFilter {
+		filter := ps.newFilter(body, out, objType)
+		if aa, ok := filter.p.(allocationAware); ok && allocations != nil {
+			aa.setAllocations(allocations)
+		}
+		filter.query = query
+		return filter
+	}
+
+	if format == formatCSV || format == formatTSV {
+		// tables are fully buffered, so errors can still be reported with a status code
+		var buf bytes.Buffer
+		filter := newListFilter(&buf)
+		if err := filter.processTable(format); err != nil {
+			lg.Error("process", "url", u, "error", err)
+			writeError(w, 502, reasonStreamError, err)
+			return
+		}
+		writeHeader()
+		buf.WriteTo(w)
 		return
 	}
 
-	filter := newFilter(resp.Body, w, ri.Key.WithEmptyVersion().String())
-	if err := filter.process(); err != nil {
-		log.Println(err)
+	writeHeader()
+	if err := newListFilter(w).process(); err != nil {
+		lg.Error("process", "url", u, "error", err)
 	}
 }
 
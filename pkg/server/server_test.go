@@ -0,0 +1,188 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newReplayHandler returns a handler serving the Kubernetes API traffic recorded in
+// testdata/replay with "kui serve --record".
+//
+// The fixtures are synthetic: they were recorded from kui serving a snapshot built
+// from testdata/pod-list.json, not from a real API server, and some were written by
+// hand. The snapshot answers every access review for the read verbs, so the
+// fixtures do not exercise real RBAC, and discovery only lists the resources in the
+// snapshot. Re-record them against a cluster to test server-specific behavior.
+func newReplayHandler(t *testing.T) APIHandler {
+	h, err := New(Config{
+		Assets:          http.Dir("testdata/app"),
+		KubeConfigFiles: []string{"testdata/replay/kubeconfig.yaml"},
+		Replay:          "testdata/replay",
+	})
+	require.Nil(t, err)
+	return h
+}
+
+// replayRequest returns a browser request to the local server.
+func replayRequest(u string) *http.Request {
+	r := httptest.NewRequest("GET", u, nil)
+	r.Host = "127.0.0.1:11491"
+	return r
+}
+
+func serveReplay(t *testing.T, h http.Handler, u string, v interface{}) {
+	r := replayRequest(u)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), v), w.Body.String())
+}
+
+func TestReplayContext(t *testing.T) {
+	h := newReplayHandler(t)
+	defer h.Close()
+
+	var contexts ContextList
+	serveReplay(t, h, "/api/contexts", &contexts)
+	require.Equal(t, []string{"dev"}, contexts.Items)
+	require.Equal(t, "dev", contexts.DefaultContext)
+
+	var ctx struct {
+		DefaultNamespace string `json:"defaultNamespace"`
+		Resources        []struct {
+			ID string `json:"id"`
+		} `json:"resources"`
+	}
+	serveReplay(t, h, "/api/contexts/dev", &ctx)
+	require.Equal(t, "default", ctx.DefaultNamespace)
+	var ids []string
+	for _, r := range ctx.Resources {
+		ids = append(ids, r.ID)
+	}
+	require.Contains(t, ids, "v1:Pod")
+	require.Contains(t, ids, "apps/v1:Deployment")
+}
+
+func TestReplayList(t *testing.T) {
+	h := newReplayHandler(t)
+	defer h.Close()
+
+	var pods struct {
+		Items []outPod `json:"items"`
+	}
+	serveReplay(t, h, "/api/contexts/dev/resources?res=v1:Pod&namespace=default", &pods)
+	require.Equal(t, 3, len(pods.Items))
+	require.Equal(t, "Guaranteed", pods.Items[0].Derived.QOSClass)
+	require.Equal(t, "ip-10-200-133-84.us-west-2.compute.internal", pods.Items[0].Derived.NodeName)
+
+	var nodes struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Derived struct {
+				Status    string `json:"status"`
+				Allocated struct {
+					Pods int `json:"pods"`
+				} `json:"allocated"`
+			} `json:"derived"`
+		} `json:"items"`
+	}
+	serveReplay(t, h, "/api/contexts/dev/resources?res=v1:Node&allocated=true", &nodes)
+	require.Equal(t, 2, len(nodes.Items))
+	require.Equal(t, "Ready", nodes.Items[0].Derived.Status)
+	require.Equal(t, 1, nodes.Items[0].Derived.Allocated.Pods)
+	require.Equal(t, 2, nodes.Items[1].Derived.Allocated.Pods)
+}
+
+func TestReplayImpersonation(t *testing.T) {
+	h := newReplayHandler(t)
+	defer h.Close()
+
+	r := replayRequest("/api/contexts/dev/resources?res=v1:Pod&namespace=default")
+	r.Header.Set(impersonateUserHeader, "jane")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, 200, w.Code, w.Body.String())
+
+	// no traffic was recorded for this user
+	r = replayRequest("/api/contexts/dev/resources?res=v1:Pod&namespace=default")
+	r.Header.Set(impersonateUserHeader, "joe")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, 502, w.Code)
+	require.Contains(t, w.Body.String(), "no recording")
+}
+
+func TestReplayDownload(t *testing.T) {
+	h := newReplayHandler(t)
+	defer h.Close()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, replayRequest("/api/contexts/dev/resources?res=v1:Pod&namespace=default&format=csv"))
+	require.Equal(t, 200, w.Code, w.Body.String())
+	require.Equal(t, "attachment; filename=pods.csv", w.Header().Get("Content-Disposition"))
+	require.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+
+	// failures are shown rather than downloaded
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, replayRequest("/api/contexts/dev/resources?res=v1:Pod&namespace=broken&format=csv"))
+	require.Equal(t, 502, w.Code)
+	require.Equal(t, "", w.Header().Get("Content-Disposition"))
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+}
+
+func TestReplaySecretRedaction(t *testing.T) {
+	h := newReplayHandler(t)
+	defer h.Close()
+
+	var secret struct {
+		Data map[string]string `json:"data"`
+	}
+	serveReplay(t, h, "/api/contexts/dev/resources/db-credentials?res=v1:Secret&namespace=default", &secret)
+	require.Equal(t, map[string]string{"password": redactedValue, "username": redactedValue}, secret.Data)
+
+	// watch events cannot be redacted
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, replayRequest("/api/contexts/dev/resources?res=v1:Secret&namespace=default&k8s.watch=true"))
+	require.Equal(t, 400, w.Code)
+}
+
+func TestReplayPermissions(t *testing.T) {
+	h := newReplayHandler(t)
+	defer h.Close()
+
+	var perms struct {
+		Namespace string              `json:"namespace"`
+		Resources map[string][]string `json:"resources"`
+	}
+	serveReplay(t, h, "/api/contexts/dev/permissions?namespace=default", &perms)
+	require.Equal(t, "default", perms.Namespace)
+	require.Equal(t, []string{"get", "list", "watch"}, perms.Resources["v1:Secret"])
+	// cluster resources are reviewed individually rather than judged from the rules
+	require.Equal(t, []string{"get", "list"}, perms.Resources["v1:Node"])
+}
+
+func TestReplayPermissionsAllNamespaces(t *testing.T) {
+	h := newReplayHandler(t)
+	defer h.Close()
+
+	// namespaced resources are reviewed across all namespaces for list and watch,
+	// cluster resources for all read verbs
+	var perms struct {
+		Namespace string              `json:"namespace"`
+		Resources map[string][]string `json:"resources"`
+		Errors    []string            `json:"errors"`
+	}
+	serveReplay(t, h, "/api/contexts/dev/permissions", &perms)
+	require.Equal(t, "", perms.Namespace)
+	require.Empty(t, perms.Errors)
+	require.Equal(t, []string{"list", "watch"}, perms.Resources["v1:Pod"])
+	require.Equal(t, []string{"list"}, perms.Resources["v1:Secret"])
+	require.Equal(t, []string{"get", "list", "watch"}, perms.Resources["v1:Namespace"])
+	require.Equal(t, []string{"get", "list"}, perms.Resources["v1:Node"])
+}
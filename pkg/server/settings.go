@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gotwarlost/kui/pkg/userconfig"
+)
+
+// maxSettingsBody is the maximum size of a settings update.
+const maxSettingsBody = 1 << 20
+
+// writeSettings writes the supplied settings as JSON.
+func writeSettings(w http.ResponseWriter, settings *userconfig.Settings) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.Encode(settings)
+}
+
+// getSettings returns the persistent user settings.
+func (s *server) getSettings(w http.ResponseWriter, r *http.Request) {
+	if s.settingsFile == "" {
+		writeErrorMessage(w, 404, reasonNotFound, "no settings file configured")
+		return
+	}
+	s.settingsLock.Lock()
+	settings, err := userconfig.LoadSettings(s.settingsFile)
+	s.settingsLock.Unlock()
+	if err != nil {
+		writeError(w, 500, reasonInternalError, err)
+		return
+	}
+	writeSettings(w, settings)
+}
+
+// putSettings replaces the persistent user settings. Settings other than UI preferences
+// take effect the next time kui is started.
+func (s *server) putSettings(w http.ResponseWriter, r *http.Request) {
+	if s.settingsFile == "" {
+		writeErrorMessage(w, 404, reasonNotFound, "no settings file configured")
+		return
+	}
+	var settings userconfig.Settings
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxSettingsBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&settings); err != nil {
+		writeErrorMessage(w, 400, reasonBadRequest, "invalid settings: "+err.Error())
+		return
+	}
+	if err := settings.Validate(); err != nil {
+		writeErrorMessage(w, 400, reasonBadRequest, "invalid settings: "+err.Error())
+		return
+	}
+	s.settingsLock.Lock()
+	err := userconfig.SaveSettings(s.settingsFile, &settings)
+	s.settingsLock.Unlock()
+	if err != nil {
+		writeError(w, 500, reasonInternalError, err)
+		return
+	}
+	writeSettings(w, &settings)
+}
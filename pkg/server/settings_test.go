@@ -0,0 +1,69 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gotwarlost/kui/pkg/userconfig"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSettings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kui-settings")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s := &server{settingsFile: filepath.Join(dir, "config.yaml")}
+
+	w := httptest.NewRecorder()
+	s.getSettings(w, httptest.NewRequest("GET", "/api/settings", nil))
+	require.Equal(t, 200, w.Code)
+	require.Equal(t, "{}\n", w.Body.String())
+
+	body := `{"port":8080,"kubeconfigFiles":["/tmp/a","/tmp/b"],"favoriteContexts":["prod"],
+"contextImpersonation":{"dev":{"user":"tenant-x"}},"hiddenKinds":["Event"],"ui":{"theme":"dark"}}`
+	w = httptest.NewRecorder()
+	s.putSettings(w, httptest.NewRequest("PUT", "/api/settings", strings.NewReader(body)))
+	require.Equal(t, 200, w.Code)
+
+	saved, err := userconfig.LoadSettings(s.settingsFile)
+	require.Nil(t, err)
+	require.Equal(t, 8080, saved.Port)
+	require.Equal(t, []string{"/tmp/a", "/tmp/b"}, saved.KubeConfigFiles)
+	require.Equal(t, "tenant-x", saved.ContextImpersonation["dev"].User)
+	require.Equal(t, "dark", saved.UI["theme"])
+	st, err := os.Stat(s.settingsFile)
+	require.Nil(t, err)
+	require.Equal(t, os.FileMode(0600), st.Mode().Perm())
+
+	w = httptest.NewRecorder()
+	s.getSettings(w, httptest.NewRequest("GET", "/api/settings", nil))
+	require.Equal(t, 200, w.Code)
+	var got userconfig.Settings
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &got))
+	require.Equal(t, []string{"prod"}, got.FavoriteContexts)
+
+	// an empty entry turns impersonation off for the context
+	w = httptest.NewRecorder()
+	s.putSettings(w, httptest.NewRequest("PUT", "/api/settings", strings.NewReader(`{"contextImpersonation":{"dev":{"user":""}}}`)))
+	require.Equal(t, 200, w.Code, w.Body.String())
+	saved, err = userconfig.LoadSettings(s.settingsFile)
+	require.Nil(t, err)
+	require.Equal(t, userconfig.Impersonation{}, saved.ContextImpersonation["dev"])
+
+	for _, bad := range []string{`{"port":-1}`, `{"unknown":true}`, `{"impersonation":{"groups":["g"]}}`,
+		`{"contextImpersonation":{"dev":{"groups":["g"]}}}`, `[`} {
+		w = httptest.NewRecorder()
+		s.putSettings(w, httptest.NewRequest("PUT", "/api/settings", strings.NewReader(bad)))
+		require.Equal(t, 400, w.Code, bad)
+	}
+
+	s = &server{}
+	w = httptest.NewRecorder()
+	s.getSettings(w, httptest.NewRequest("GET", "/api/settings", nil))
+	require.Equal(t, 404, w.Code)
+}
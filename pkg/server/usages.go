@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/dimfeld/httptreemux"
+)
+
+// usageKinds are the versionless resource keys of the kinds for which usages can be
+// looked up. Keys include the group, such that custom resources reusing these kind
+// names are not matched.
+var usageKinds = map[string]bool{
+	"/:ConfigMap":             true,
+	"/:Secret":                true,
+	"/:PersistentVolumeClaim": true,
+	"/:ServiceAccount":        true,
+}
+
+// Usage is a pod or workload that references an object.
+type Usage struct {
+	Resource   string   `json:"resource"`   // the resource key of the referencing object
+	Kind       string   `json:"kind"`       // the kind of the referencing object
+	Namespace  string   `json:"namespace"`  // the namespace of the referencing object
+	Name       string   `json:"name"`       // the name of the referencing object
+	References []string `json:"references"` // how the object is referenced (volume, env, envFrom, ...)
+}
+
+// UsageList is the list of usages of an object.
+type UsageList struct {
+	Items  []Usage  `json:"items"`            // referencing objects
+	Errors []string `json:"errors,omitempty"` // load errors for workload kinds, if any
+}
+
+// findUsages returns the objects whose pod specs reference the object of the supplied
+// kind and name. Pods and templates that do not specify a service account are treated
+// as using the default service account.
+func findUsages(kind, name string, objects []*graphObject) ([]Usage, error) {
+	ret := []Usage{}
+	for _, o := range objects {
+		spec, err := o.podSpec()
+		if err != nil {
+			return nil, err
+		}
+		if spec == nil {
+			continue
+		}
+		var refs []string
+		for _, ref := range podRefs(spec) {
+			if ref.kind == kind && ref.name == name {
+				refs = append(refs, ref.relation)
+			}
+		}
+		if kind == "ServiceAccount" && name == "default" && spec.ServiceAccountName == "" && spec.DeprecatedServiceAccount == "" {
+			refs = append(refs, relationServiceAccount)
+		}
+		if len(refs) == 0 {
+			continue
+		}
+		ret = append(ret, Usage{
+			Resource:   o.resource,
+			Kind:       o.Kind,
+			Namespace:  o.Metadata.Namespace,
+			Name:       o.Metadata.Name,
+			References: refs,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Kind != ret[j].Kind {
+			return ret[i].Kind < ret[j].Kind
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
+
+// getUsages returns the pods and workloads that reference a config map, secret,
+// persistent volume claim or service account.
+func (s *server) getUsages(w http.ResponseWriter, r *http.Request) {
+	p := httptreemux.ContextParams(r.Context())
+	cfg, err := s.getConfig()
+	if err != nil {
+		writeError(w, 500, reasonConfigError, err)
+		return
+	}
+
+	r.ParseForm()
+
+	ctx := p[contextParamName]
+	id := p[resourceIDParamName]
+	ns := r.Form.Get(namespaceQueryParam)
+
+	ri, err := s.getResourceInfo(cfg, ctx, r.Form.Get(resourceQueryParam))
+	if err != nil {
+		writeResourceInfoError(w, err)
+		return
+	}
+	if !usageKinds[ri.Key.WithEmptyVersion().String()] || ns == "" {
+		writeErrorMessage(w, 400, reasonBadRequest,
+			"usages are only supported for config maps, secrets, persistent volume claims and service accounts, with a namespace")
+		return
+	}
+	rr, err := s.getRegistry(cfg, ctx)
+	if err != nil {
+		writeError(w, 500, reasonRegistryError, err)
+		return
+	}
+	imp, err := s.impersonationFor(r, ctx)
+	if err != nil {
+		writeErrorMessage(w, 400, reasonBadRequest, "invalid impersonation: "+err.Error())
+		return
+	}
+	conn, err := s.getConn(cfg, ctx, imp)
+	if err != nil {
+		writeError(w, 500, reasonConnectionError, err)
+		return
+	}
+
+	objects, errs := loadGraphObjects(r.Context(), conn, rr, ns)
+	usages, err := findUsages(ri.Key.Kind, id, objects)
+	if err != nil {
+		writeError(w, 500, reasonInternalError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.Encode(UsageList{Items: usages, Errors: errs})
+}
@@ -0,0 +1,169 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// dumpMarkerFile is the file at the root of a cluster-info dump.
+	dumpMarkerFile = "nodes.json"
+	// dumpDir is the context directory of a cluster-info dump.
+	dumpDir = "dump"
+)
+
+// dumpResource is a resource in a cluster-info dump.
+type dumpResource struct {
+	groupVersion string // "" for the core group
+	name         string // the API path name
+	kind         string
+	namespaced   bool
+}
+
+// dumpFiles are the lists written by "kubectl cluster-info dump --output-directory",
+// at the root for cluster resources and in a directory per namespace otherwise.
+var dumpFiles = map[string]dumpResource{
+	"nodes.json":                   {"v1", "nodes", "Node", false},
+	"events.json":                  {"v1", "events", "Event", true},
+	"pods.json":                    {"v1", "pods", "Pod", true},
+	"replication-controllers.json": {"v1", "replicationcontrollers", "ReplicationController", true},
+	"services.json":                {"v1", "services", "Service", true},
+	"daemonsets.json":              {"apps/v1", "daemonsets", "DaemonSet", true},
+	"deployments.json":             {"apps/v1", "deployments", "Deployment", true},
+	"replicasets.json":             {"apps/v1", "replicasets", "ReplicaSet", true},
+}
+
+// namespaceResource is the namespace resource, whose list is derived from the
+// namespace directories of a dump.
+var namespaceResource = dumpResource{"v1", "namespaces", "Namespace", false}
+
+// apiPrefix returns the API path prefix of a group version.
+func apiPrefix(gv string) string {
+	if strings.Contains(gv, "/") {
+		return "/apis/" + gv
+	}
+	return "/api/" + gv
+}
+
+// fromClusterInfoDump returns a single-context snapshot for the output directory of
+// "kubectl cluster-info dump". Discovery documents are synthesized for the resources
+// in the dump.
+func fromClusterInfoDump(src source, ctx string) (*Snapshot, error) {
+	m := memSource{}
+	namespaces := map[string]bool{}
+	for _, name := range src.names() {
+		dir, file := path.Split(name)
+		res, ok := dumpFiles[file]
+		if !ok {
+			continue
+		}
+		ns := strings.TrimSuffix(dir, "/")
+		if strings.Contains(ns, "/") || (ns == "") == res.namespaced {
+			continue
+		}
+		b, err := src.read(name)
+		if err != nil {
+			return nil, err
+		}
+		p := apiPrefix(res.groupVersion) + "/" + res.name
+		if res.namespaced {
+			p = apiPrefix(res.groupVersion) + "/namespaces/" + ns + "/" + res.name
+			namespaces[ns] = true
+		}
+		m[dumpDir+p+".json"] = b
+	}
+
+	var nsNames []string
+	for ns := range namespaces {
+		nsNames = append(nsNames, ns)
+	}
+	sort.Strings(nsNames)
+	nsList := list{Kind: "NamespaceList", APIVersion: "v1", Metadata: json.RawMessage("{}"), Items: []json.RawMessage{}}
+	for _, ns := range nsNames {
+		b, err := json.Marshal(map[string]interface{}{
+			"kind":       "Namespace",
+			"apiVersion": "v1",
+			"metadata":   map[string]interface{}{"name": ns},
+			"status":     map[string]interface{}{"phase": "Active"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		nsList.Items = append(nsList.Items, b)
+	}
+	if err := putJSON(m, dumpDir+"/api/v1/namespaces.json", nsList); err != nil {
+		return nil, err
+	}
+
+	resources := map[string][]v1.APIResource{}
+	for _, res := range append(dumpResourceList(), namespaceResource) {
+		resources[res.groupVersion] = append(resources[res.groupVersion], v1.APIResource{
+			Name:       res.name,
+			Namespaced: res.namespaced,
+			Kind:       res.kind,
+			Verbs:      v1.Verbs(readOnlyVerbs),
+		})
+	}
+	groups := v1.APIGroupList{TypeMeta: v1.TypeMeta{Kind: "APIGroupList", APIVersion: "v1"}}
+	for gv, rs := range resources {
+		sort.Slice(rs, func(i, j int) bool { return rs[i].Name < rs[j].Name })
+		rl := v1.APIResourceList{TypeMeta: v1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"}, GroupVersion: gv, APIResources: rs}
+		if err := putJSON(m, dumpDir+apiPrefix(gv)+".json", rl); err != nil {
+			return nil, err
+		}
+		if !strings.Contains(gv, "/") {
+			continue
+		}
+		parts := strings.SplitN(gv, "/", 2)
+		version := v1.GroupVersionForDiscovery{GroupVersion: gv, Version: parts[1]}
+		groups.Groups = append(groups.Groups, v1.APIGroup{Name: parts[0], Versions: []v1.GroupVersionForDiscovery{version}, PreferredVersion: version})
+	}
+	sort.Slice(groups.Groups, func(i, j int) bool { return groups.Groups[i].Name < groups.Groups[j].Name })
+	versions := v1.APIVersions{TypeMeta: v1.TypeMeta{Kind: "APIVersions"}, Versions: []string{"v1"}}
+	if err := putJSON(m, dumpDir+"/api.json", versions); err != nil {
+		return nil, err
+	}
+	if err := putJSON(m, dumpDir+"/apis.json", groups); err != nil {
+		return nil, err
+	}
+
+	defaultNamespace := "default"
+	if !namespaces[defaultNamespace] && len(nsNames) > 0 {
+		defaultNamespace = nsNames[0]
+	}
+	return &Snapshot{
+		meta: Metadata{
+			Version:  FormatVersion,
+			Contexts: []ContextInfo{{Name: ctx, Dir: dumpDir, Namespace: defaultNamespace}},
+		},
+		src: m,
+	}, nil
+}
+
+// dumpResourceList returns the resources of a dump in a stable order.
+func dumpResourceList() []dumpResource {
+	var files []string
+	for f := range dumpFiles {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	var ret []dumpResource
+	for _, f := range files {
+		ret = append(ret, dumpFiles[f])
+	}
+	return ret
+}
+
+// putJSON stores the JSON encoding of the supplied value in the source.
+func putJSON(m memSource, name string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	m[name] = b
+	return nil
+}
@@ -0,0 +1,546 @@
+// Package snapshot serves Kubernetes API requests from a saved dump of one or more
+// clusters, such that kui can be used without a live cluster.
+//
+// A kui snapshot is a directory, or a tarball of one, with a metadata file and a
+// directory per context. Each API response is stored in the context directory at
+// its API path with a ".json" extension, for example prod/api.json for the /api
+// discovery document and prod/apis/apps/v1/namespaces/default/deployments.json
+// for a list of deployments. Lists may be stored for all namespaces, for single
+// namespaces, or both. List requests support label selectors and field selectors
+// on metadata.name, metadata.namespace and status.phase. The output directory of
+// "kubectl cluster-info dump" is also accepted and served as a single context.
+package snapshot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gotwarlost/kui/pkg/kubeconfig"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	// MetadataFile is the name of the metadata file at the root of a kui snapshot.
+	MetadataFile = "kui-snapshot.json"
+	// FormatVersion is the snapshot format version written by this package.
+	FormatVersion = 1
+	// server is the server URL of snapshot contexts, which is never contacted.
+	server = "http://snapshot.invalid"
+)
+
+// ContextInfo describes a context in a snapshot.
+type ContextInfo struct {
+	Name      string `json:"name"`                // the context name
+	Dir       string `json:"dir"`                 // the directory with the API responses of the context
+	Namespace string `json:"namespace,omitempty"` // the default namespace of the context
+}
+
+// Metadata describes a snapshot.
+type Metadata struct {
+	Version  int           `json:"version"`          // the format version
+	Created  time.Time     `json:"created"`          // the time the snapshot was taken
+	Contexts []ContextInfo `json:"contexts"`         // the contexts in the snapshot
+	Redacted bool          `json:"redacted"`         // true if sensitive values were redacted
+	Errors   []string      `json:"errors,omitempty"` // API responses that could not be saved
+}
+
+// Snapshot is a saved dump of one or more clusters.
+type Snapshot struct {
+	meta Metadata
+	src  source
+}
+
+// Open opens the snapshot at the supplied path, which may be a directory or a
+// tarball, optionally gzipped, of a kui snapshot or of a cluster-info dump.
+func Open(file string) (*Snapshot, error) {
+	st, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	var src source
+	if st.IsDir() {
+		src, err = newDirSource(file)
+	} else {
+		src, err = newTarSource(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if prefix, ok := rootOf(src, MetadataFile); ok {
+		src = &subSource{src: src, prefix: prefix}
+		b, err := src.read(MetadataFile)
+		if err != nil {
+			return nil, err
+		}
+		var meta Metadata
+		if err := json.Unmarshal(b, &meta); err != nil {
+			return nil, errors.Wrapf(err, "parse %s", MetadataFile)
+		}
+		if meta.Version != FormatVersion {
+			return nil, fmt.Errorf("unsupported snapshot version %d", meta.Version)
+		}
+		return &Snapshot{meta: meta, src: src}, nil
+	}
+	if prefix, ok := rootOf(src, dumpMarkerFile); ok {
+		return fromClusterInfoDump(&subSource{src: src, prefix: prefix}, dumpContextName(file))
+	}
+	return nil, fmt.Errorf("%s is neither a kui snapshot nor a cluster-info dump", file)
+}
+
+// dumpContextName returns the context name for a cluster-info dump, derived from its file name.
+func dumpContextName(file string) string {
+	name := filepath.Base(filepath.Clean(file))
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	if name == "" || name == "." || name == string(filepath.Separator) {
+		return "cluster-info-dump"
+	}
+	return name
+}
+
+// Metadata returns the metadata of the snapshot.
+func (s *Snapshot) Metadata() Metadata {
+	return s.meta
+}
+
+// KubeConfig returns a configuration with the contexts of the snapshot. The
+// REST configuration of a context must use the transport of the context.
+func (s *Snapshot) KubeConfig() *kubeconfig.Config {
+	c := api.NewConfig()
+	for _, ci := range s.meta.Contexts {
+		cluster := api.NewCluster()
+		cluster.Server = server
+		c.Clusters[ci.Name] = cluster
+		c.AuthInfos[ci.Name] = api.NewAuthInfo()
+		ctx := api.NewContext()
+		ctx.Cluster = ci.Name
+		ctx.AuthInfo = ci.Name
+		ctx.Namespace = ci.Namespace
+		c.Contexts[ci.Name] = ctx
+	}
+	if len(s.meta.Contexts) > 0 {
+		c.CurrentContext = s.meta.Contexts[0].Name
+	}
+	return kubeconfig.FromRaw(*c)
+}
+
+// Transport returns a round tripper that serves the API requests of the supplied
+// context from the snapshot.
+func (s *Snapshot) Transport(ctx string) http.RoundTripper {
+	for _, ci := range s.meta.Contexts {
+		if ci.Name == ctx {
+			return &transport{s: s, dir: ci.Dir}
+		}
+	}
+	return &transport{s: s}
+}
+
+// apiPath is a parsed resource path of the Kubernetes API.
+type apiPath struct {
+	groupVersion string // "/api/v1" or "/apis/<group>/<version>"
+	namespace    string
+	resource     string
+	name         string
+}
+
+// parseAPIPath parses a list or object path. Discovery and subresource paths are
+// not resource paths.
+func parseAPIPath(p string) (apiPath, bool) {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	var prefix int
+	switch parts[0] {
+	case "api":
+		prefix = 2
+	case "apis":
+		prefix = 3
+	default:
+		return apiPath{}, false
+	}
+	if len(parts) <= prefix {
+		return apiPath{}, false
+	}
+	ap := apiPath{groupVersion: "/" + strings.Join(parts[:prefix], "/")}
+	rest := parts[prefix:]
+	if rest[0] == "namespaces" && len(rest) >= 3 {
+		ap.namespace = rest[1]
+		rest = rest[2:]
+	}
+	switch len(rest) {
+	case 1:
+		ap.resource = rest[0]
+	case 2:
+		ap.resource, ap.name = rest[0], rest[1]
+	default:
+		return apiPath{}, false
+	}
+	return ap, true
+}
+
+// discoveryGroupVersion returns the group version of a group version discovery
+// path such as /api/v1 or /apis/apps/v1.
+func discoveryGroupVersion(p string) (string, bool) {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	switch {
+	case len(parts) == 2 && parts[0] == "api":
+		return parts[1], true
+	case len(parts) == 3 && parts[0] == "apis":
+		return parts[1] + "/" + parts[2], true
+	}
+	return "", false
+}
+
+// listPath returns the list path of the resource in the namespace of the path.
+func (ap apiPath) listPath(namespace string) string {
+	if namespace == "" {
+		return ap.groupVersion + "/" + ap.resource
+	}
+	return ap.groupVersion + "/namespaces/" + namespace + "/" + ap.resource
+}
+
+// list is a list of objects as returned by the API.
+type list struct {
+	Kind       string            `json:"kind"`
+	APIVersion string            `json:"apiVersion"`
+	Metadata   json.RawMessage   `json:"metadata"`
+	Items      []json.RawMessage `json:"items"`
+}
+
+// objectMeta is the part of the metadata of an object used to select it.
+type objectMeta struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+}
+
+func (s *Snapshot) readList(dir, p string) (*list, bool, error) {
+	b, err := s.src.read(dir + p + ".json")
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var l list
+	if err := json.Unmarshal(b, &l); err != nil {
+		return nil, false, errors.Wrapf(err, "parse %s", dir+p+".json")
+	}
+	if len(l.Metadata) == 0 {
+		l.Metadata = json.RawMessage("{}")
+	}
+	if l.Items == nil {
+		l.Items = []json.RawMessage{}
+	}
+	return &l, true, nil
+}
+
+// list returns the list for the supplied path. Namespaced lists are filtered from
+// the list for all namespaces and lists for all namespaces are merged from the
+// namespaced lists when they are not stored. Lists that are not stored at all
+// are empty.
+func (s *Snapshot) list(dir string, ap apiPath) (*list, error) {
+	l, ok, err := s.readList(dir, ap.listPath(ap.namespace))
+	if ok || err != nil {
+		return l, err
+	}
+	ret := &list{Kind: "List", APIVersion: "v1", Metadata: json.RawMessage("{}"), Items: []json.RawMessage{}}
+	if ap.namespace != "" {
+		all, ok, err := s.readList(dir, ap.listPath(""))
+		if !ok || err != nil {
+			return ret, err
+		}
+		ret.Kind, ret.APIVersion = all.Kind, all.APIVersion
+		for _, item := range all.Items {
+			var om objectMeta
+			if err := json.Unmarshal(item, &om); err != nil {
+				return nil, err
+			}
+			if om.Metadata.Namespace == ap.namespace {
+				ret.Items = append(ret.Items, item)
+			}
+		}
+		return ret, nil
+	}
+	prefix := dir + ap.groupVersion + "/namespaces/"
+	suffix := "/" + ap.resource + ".json"
+	for _, name := range s.src.names() {
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		ns := strings.TrimSuffix(strings.TrimPrefix(name, prefix), suffix)
+		if ns == "" || strings.Contains(ns, "/") {
+			continue
+		}
+		nl, ok, err := s.readList(dir, ap.listPath(ns))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		ret.Kind, ret.APIVersion = nl.Kind, nl.APIVersion
+		ret.Items = append(ret.Items, nl.Items...)
+	}
+	return ret, nil
+}
+
+// object returns the object for the supplied path, with the kind and API version
+// set from the list when the stored item does not have them.
+func (s *Snapshot) object(dir string, ap apiPath) ([]byte, bool, error) {
+	lp := ap
+	lp.name = ""
+	l, err := s.list(dir, lp)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, item := range l.Items {
+		var om objectMeta
+		if err := json.Unmarshal(item, &om); err != nil {
+			return nil, false, err
+		}
+		if om.Metadata.Name != ap.name {
+			continue
+		}
+		var obj map[string]interface{}
+		if err := json.Unmarshal(item, &obj); err != nil {
+			return nil, false, err
+		}
+		if _, ok := obj["kind"]; !ok && strings.HasSuffix(l.Kind, "List") && l.Kind != "List" {
+			obj["kind"] = strings.TrimSuffix(l.Kind, "List")
+		}
+		if _, ok := obj["apiVersion"]; !ok {
+			obj["apiVersion"] = l.APIVersion
+		}
+		b, err := json.Marshal(obj)
+		return b, true, err
+	}
+	return nil, false, nil
+}
+
+// selectableObject is the part of an object that list selectors match against.
+type selectableObject struct {
+	Metadata struct {
+		Name      string            `json:"name"`
+		Namespace string            `json:"namespace"`
+		Labels    map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Status struct {
+		Phase string `json:"phase"`
+	} `json:"status"`
+}
+
+// fields returns the values of the fields that snapshots support in field selectors.
+func (o selectableObject) fields() fields.Set {
+	return fields.Set{
+		"metadata.name":      o.Metadata.Name,
+		"metadata.namespace": o.Metadata.Namespace,
+		"status.phase":       o.Status.Phase,
+	}
+}
+
+// listSelector is the label and field selector of a list request.
+type listSelector struct {
+	labels labels.Selector
+	fields fields.Selector
+}
+
+// parseListSelector returns the selector for the supplied query. Field selectors
+// are only supported for the fields returned by selectableObject.fields.
+func parseListSelector(q url.Values) (listSelector, error) {
+	ls, err := labels.Parse(q.Get("labelSelector"))
+	if err != nil {
+		return listSelector{}, errors.Wrap(err, "invalid label selector")
+	}
+	fs, err := fields.ParseSelector(q.Get("fieldSelector"))
+	if err != nil {
+		return listSelector{}, errors.Wrap(err, "invalid field selector")
+	}
+	supported := selectableObject{}.fields()
+	for _, r := range fs.Requirements() {
+		if _, ok := supported[r.Field]; !ok {
+			return listSelector{}, fmt.Errorf("field selector %q is not supported by snapshots", r.Field)
+		}
+	}
+	return listSelector{labels: ls, fields: fs}, nil
+}
+
+func (sel listSelector) empty() bool {
+	return sel.labels.Empty() && sel.fields.Empty()
+}
+
+// filter removes the items that do not match the selector from the supplied list.
+func (sel listSelector) filter(l *list) error {
+	items := []json.RawMessage{}
+	for _, item := range l.Items {
+		var o selectableObject
+		if err := json.Unmarshal(item, &o); err != nil {
+			return err
+		}
+		if sel.labels.Matches(labels.Set(o.Metadata.Labels)) && sel.fields.Matches(o.fields()) {
+			items = append(items, item)
+		}
+	}
+	l.Items = items
+	return nil
+}
+
+// transport serves the API requests of a context from a snapshot.
+type transport struct {
+	s   *Snapshot
+	dir string // the context directory, empty for unknown contexts
+}
+
+// readOnlyVerbs are the verbs allowed on every resource of a snapshot.
+var readOnlyVerbs = []string{"get", "list", "watch"}
+
+// RoundTrip implements the round tripper interface.
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body []byte
+	if r.Body != nil {
+		b, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+	if t.dir == "" {
+		return response(r, http.StatusNotFound, status(http.StatusNotFound, "NotFound", "context not found in snapshot"))
+	}
+	p := "/" + strings.Trim(r.URL.Path, "/")
+	if r.Method == http.MethodPost && strings.HasPrefix(p, "/apis/authorization.k8s.io/") {
+		return t.review(r, p, body)
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return response(r, http.StatusMethodNotAllowed, status(http.StatusMethodNotAllowed, "MethodNotAllowed", "snapshots are read-only"))
+	}
+	sel, err := parseListSelector(r.URL.Query())
+	if err != nil {
+		return response(r, http.StatusBadRequest, status(http.StatusBadRequest, "BadRequest", err.Error()))
+	}
+	ap, ok := parseAPIPath(p)
+	if !ok || ap.name != "" || sel.empty() {
+		b, err := t.s.src.read(t.dir + p + ".json")
+		if err == nil {
+			return response(r, http.StatusOK, b)
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if gv, ok := discoveryGroupVersion(p); ok {
+		// group versions whose discovery failed when the snapshot was taken have no resources
+		b, err := json.Marshal(map[string]interface{}{"kind": "APIResourceList", "apiVersion": "v1", "groupVersion": gv, "resources": []interface{}{}})
+		if err != nil {
+			return nil, err
+		}
+		return response(r, http.StatusOK, b)
+	}
+	if !ok {
+		return response(r, http.StatusNotFound, status(http.StatusNotFound, "NotFound", "the server could not find the requested resource"))
+	}
+	if ap.name == "" {
+		l, err := t.s.list(t.dir, ap)
+		if err != nil {
+			return nil, err
+		}
+		if err := sel.filter(l); err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(l)
+		if err != nil {
+			return nil, err
+		}
+		return response(r, http.StatusOK, b)
+	}
+	b, found, err := t.s.object(t.dir, ap)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return response(r, http.StatusNotFound, status(http.StatusNotFound, "NotFound", fmt.Sprintf("%s %q not found", ap.resource, ap.name)))
+	}
+	return response(r, http.StatusOK, b)
+}
+
+// review answers self subject reviews such that everything in the snapshot can be read.
+func (t *transport) review(r *http.Request, p string, body []byte) (*http.Response, error) {
+	var review map[string]interface{}
+	if err := json.Unmarshal(body, &review); err != nil {
+		return response(r, http.StatusBadRequest, status(http.StatusBadRequest, "BadRequest", err.Error()))
+	}
+	switch {
+	case strings.HasSuffix(p, "/selfsubjectrulesreviews"):
+		review["status"] = map[string]interface{}{
+			"resourceRules": []interface{}{
+				map[string]interface{}{"verbs": readOnlyVerbs, "apiGroups": []string{"*"}, "resources": []string{"*"}},
+			},
+			"nonResourceRules": []interface{}{},
+			"incomplete":       false,
+		}
+	case strings.HasSuffix(p, "/selfsubjectaccessreviews"):
+		var spec struct {
+			Spec struct {
+				ResourceAttributes struct {
+					Verb string `json:"verb"`
+				} `json:"resourceAttributes"`
+			} `json:"spec"`
+		}
+		if err := json.Unmarshal(body, &spec); err != nil {
+			return response(r, http.StatusBadRequest, status(http.StatusBadRequest, "BadRequest", err.Error()))
+		}
+		allowed := false
+		for _, v := range readOnlyVerbs {
+			allowed = allowed || v == spec.Spec.ResourceAttributes.Verb
+		}
+		review["status"] = map[string]interface{}{"allowed": allowed}
+	default:
+		return response(r, http.StatusMethodNotAllowed, status(http.StatusMethodNotAllowed, "MethodNotAllowed", "snapshots are read-only"))
+	}
+	b, err := json.Marshal(review)
+	if err != nil {
+		return nil, err
+	}
+	return response(r, http.StatusCreated, b)
+}
+
+// status returns a failure status object as returned by the API.
+func status(code int, reason, message string) []byte {
+	b, _ := json.Marshal(map[string]interface{}{
+		"kind":       "Status",
+		"apiVersion": "v1",
+		"metadata":   map[string]interface{}{},
+		"status":     "Failure",
+		"message":    message,
+		"reason":     reason,
+		"code":       code,
+	})
+	return b
+}
+
+// response returns a JSON response for the supplied request.
+func response(r *http.Request, code int, b []byte) (*http.Response, error) {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(b)),
+		ContentLength: int64(len(b)),
+		Request:       r,
+	}, nil
+}
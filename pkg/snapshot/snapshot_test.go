@@ -0,0 +1,394 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testPods = `{
+  "kind": "PodList",
+  "apiVersion": "v1",
+  "metadata": {},
+  "items": [
+    {"metadata": {"name": "web-1", "namespace": "default", "labels": {"app": "web"}}, "status": {"phase": "Running"}},
+    {"metadata": {"name": "job-1", "namespace": "default", "labels": {"app": "job"}}, "status": {"phase": "Succeeded"}},
+    {"metadata": {"name": "dns-1", "namespace": "kube-system", "labels": {"app": "dns"}}, "status": {"phase": "Failed"}}
+  ]
+}`
+
+// testDeployments returns a deployment list for a namespace.
+func testDeployments(namespace string) []byte {
+	return []byte(`{"kind": "DeploymentList", "apiVersion": "apps/v1", "metadata": {}, "items": [
+		{"metadata": {"name": "` + namespace + `-app", "namespace": "` + namespace + `"}}
+	]}`)
+}
+
+// writeTestSnapshot writes a snapshot below the supplied directory and returns its
+// directory. The snapshot has a context named dev with a pod list for all namespaces
+// and deployment lists for single namespaces.
+func writeTestSnapshot(t *testing.T, dir string) string {
+	root := filepath.Join(dir, "snap")
+	w, err := NewDirWriter(root)
+	require.Nil(t, err)
+	cd := w.AddContext("dev", "default")
+	require.Nil(t, w.WriteResponse(cd, "/api", []byte(`{"kind": "APIVersions", "versions": ["v1"]}`)))
+	require.Nil(t, w.WriteResponse(cd, "/api/v1/pods", []byte(testPods)))
+	require.Nil(t, w.WriteResponse(cd, "/apis/apps/v1/namespaces/default/deployments", testDeployments("default")))
+	require.Nil(t, w.WriteResponse(cd, "/apis/apps/v1/namespaces/kube-system/deployments", testDeployments("kube-system")))
+	w.SetRedacted(true)
+	require.Nil(t, w.Close())
+	return root
+}
+
+// writeTar writes the files below the supplied directory to a tarball, with names
+// prefixed by the supplied prefix.
+func writeTar(t *testing.T, dir, file, prefix string, gzipped bool) {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var gz *gzip.Writer
+	if gzipped {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: prefix + filepath.ToSlash(rel), Mode: 0600, Size: int64(len(b))}); err != nil {
+			return err
+		}
+		_, err = tw.Write(b)
+		return err
+	})
+	require.Nil(t, err)
+	require.Nil(t, tw.Close())
+	if gz != nil {
+		require.Nil(t, gz.Close())
+	}
+	require.Nil(t, ioutil.WriteFile(file, buf.Bytes(), 0600))
+}
+
+// do makes a request for the supplied path using the transport of the supplied context.
+func do(t *testing.T, s *Snapshot, ctx, method, p, body string) (int, []byte) {
+	r, err := http.NewRequest(method, server+p, strings.NewReader(body))
+	require.Nil(t, err)
+	res, err := s.Transport(ctx).RoundTrip(r)
+	require.Nil(t, err)
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	require.Nil(t, err)
+	return res.StatusCode, b
+}
+
+// get makes a GET request for the supplied path using the transport of the supplied context.
+func get(t *testing.T, s *Snapshot, ctx, p string) (int, []byte) {
+	return do(t, s, ctx, http.MethodGet, p, "")
+}
+
+// itemNames returns the sorted names of the items in a list.
+func itemNames(t *testing.T, b []byte) []string {
+	var l struct {
+		Items []objectMeta `json:"items"`
+	}
+	require.Nil(t, json.Unmarshal(b, &l))
+	names := []string{}
+	for _, item := range l.Items {
+		names = append(names, item.Metadata.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestSelectors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kui-snapshot")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s, err := Open(writeTestSnapshot(t, dir))
+	require.Nil(t, err)
+	tests := []struct {
+		path  string
+		names []string
+	}{
+		{"/api/v1/pods", []string{"dns-1", "job-1", "web-1"}},
+		{"/api/v1/pods?labelSelector=app%3Dweb", []string{"web-1"}},
+		{"/api/v1/pods?labelSelector=app+in+%28web%2Cdns%29", []string{"dns-1", "web-1"}},
+		{"/api/v1/namespaces/default/pods?labelSelector=app%21%3Dweb", []string{"job-1"}},
+		{"/api/v1/pods?fieldSelector=status.phase%21%3DSucceeded%2Cstatus.phase%21%3DFailed", []string{"web-1"}},
+		{"/api/v1/pods?fieldSelector=metadata.namespace%3Dkube-system", []string{"dns-1"}},
+		{"/api/v1/pods?fieldSelector=metadata.name%3Djob-1&labelSelector=app%3Djob", []string{"job-1"}},
+	}
+	for _, test := range tests {
+		code, b := get(t, s, "dev", test.path)
+		require.Equal(t, 200, code, test.path)
+		require.Equal(t, test.names, itemNames(t, b), test.path)
+	}
+
+	for _, p := range []string{
+		"/api/v1/pods?fieldSelector=spec.nodeName%3Dnode-1",
+		"/api/v1/pods?labelSelector=app%3D%3D%3D",
+	} {
+		code, b := get(t, s, "dev", p)
+		require.Equal(t, 400, code, p)
+		require.Contains(t, string(b), `"reason":"BadRequest"`)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kui-snapshot")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	root := writeTestSnapshot(t, dir)
+	tarFile := filepath.Join(dir, "snap.tar")
+	writeTar(t, root, tarFile, "", false)
+	tgzFile := filepath.Join(dir, "snap.tgz")
+	writeTar(t, root, tgzFile, "", true)
+	nestedFile := filepath.Join(dir, "nested.tar.gz")
+	writeTar(t, root, nestedFile, "kui-snapshot-dev/", true)
+
+	for _, file := range []string{root, tarFile, tgzFile, nestedFile} {
+		s, err := Open(file)
+		require.Nil(t, err, file)
+		meta := s.Metadata()
+		require.Equal(t, FormatVersion, meta.Version)
+		require.True(t, meta.Redacted)
+		require.Equal(t, []ContextInfo{{Name: "dev", Dir: "dev", Namespace: "default"}}, meta.Contexts)
+		code, b := get(t, s, "dev", "/api/v1/pods")
+		require.Equal(t, 200, code, file)
+		require.Equal(t, []string{"dns-1", "job-1", "web-1"}, itemNames(t, b), file)
+
+		kc := s.KubeConfig()
+		require.Equal(t, []string{"dev"}, kc.ContextNames())
+		require.Equal(t, "default", kc.DefaultNamespaceForContext("dev"))
+	}
+
+	_, err = Open(filepath.Join(dir, "missing"))
+	require.NotNil(t, err)
+	empty := filepath.Join(dir, "empty")
+	require.Nil(t, os.Mkdir(empty, 0700))
+	_, err = Open(empty)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "neither a kui snapshot nor a cluster-info dump")
+}
+
+func TestOpenClusterInfoDump(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kui-snapshot")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "prod-dump")
+	files := map[string]string{
+		"nodes.json":               `{"kind": "NodeList", "apiVersion": "v1", "metadata": {}, "items": [{"metadata": {"name": "node-1"}}]}`,
+		"default/pods.json":        `{"kind": "PodList", "apiVersion": "v1", "metadata": {}, "items": [{"metadata": {"name": "web-1", "namespace": "default"}}]}`,
+		"kube-system/pods.json":    `{"kind": "PodList", "apiVersion": "v1", "metadata": {}, "items": [{"metadata": {"name": "dns-1", "namespace": "kube-system"}}]}`,
+		"default/deployments.json": string(testDeployments("default")),
+		"default/unknown.json":     `{}`,
+	}
+	for name, content := range files {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		require.Nil(t, os.MkdirAll(filepath.Dir(file), 0700))
+		require.Nil(t, ioutil.WriteFile(file, []byte(content), 0600))
+	}
+	tgzFile := filepath.Join(dir, "prod-dump.tar.gz")
+	writeTar(t, root, tgzFile, "cluster-info/", true)
+
+	for _, file := range []string{root, tgzFile} {
+		s, err := Open(file)
+		require.Nil(t, err, file)
+		require.Equal(t, []ContextInfo{{Name: "prod-dump", Dir: dumpDir, Namespace: "default"}}, s.Metadata().Contexts)
+
+		code, b := get(t, s, "prod-dump", "/api/v1/nodes")
+		require.Equal(t, 200, code)
+		require.Equal(t, []string{"node-1"}, itemNames(t, b))
+		code, b = get(t, s, "prod-dump", "/api/v1/pods")
+		require.Equal(t, 200, code)
+		require.Equal(t, []string{"dns-1", "web-1"}, itemNames(t, b))
+		code, b = get(t, s, "prod-dump", "/api/v1/namespaces")
+		require.Equal(t, 200, code)
+		require.Equal(t, []string{"default", "kube-system"}, itemNames(t, b))
+
+		code, b = get(t, s, "prod-dump", "/apis/apps/v1")
+		require.Equal(t, 200, code)
+		var rl struct {
+			GroupVersion string `json:"groupVersion"`
+			Resources    []struct {
+				Name       string `json:"name"`
+				Namespaced bool   `json:"namespaced"`
+			} `json:"resources"`
+		}
+		require.Nil(t, json.Unmarshal(b, &rl))
+		require.Equal(t, "apps/v1", rl.GroupVersion)
+		require.Equal(t, 3, len(rl.Resources))
+		require.Equal(t, "daemonsets", rl.Resources[0].Name)
+		require.True(t, rl.Resources[0].Namespaced)
+
+		code, b = get(t, s, "prod-dump", "/apis")
+		require.Equal(t, 200, code)
+		require.Contains(t, string(b), `"name":"apps"`)
+	}
+}
+
+func TestList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kui-snapshot")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s, err := Open(writeTestSnapshot(t, dir))
+	require.Nil(t, err)
+
+	// a namespace is filtered from the list for all namespaces
+	code, b := get(t, s, "dev", "/api/v1/namespaces/kube-system/pods")
+	require.Equal(t, 200, code)
+	require.Equal(t, []string{"dns-1"}, itemNames(t, b))
+	var l list
+	require.Nil(t, json.Unmarshal(b, &l))
+	require.Equal(t, "PodList", l.Kind)
+	require.Equal(t, "v1", l.APIVersion)
+
+	// the list for all namespaces is merged from the namespaced lists
+	code, b = get(t, s, "dev", "/apis/apps/v1/deployments")
+	require.Equal(t, 200, code)
+	require.Equal(t, []string{"default-app", "kube-system-app"}, itemNames(t, b))
+	require.Nil(t, json.Unmarshal(b, &l))
+	require.Equal(t, "DeploymentList", l.Kind)
+	require.Equal(t, "apps/v1", l.APIVersion)
+
+	// stored namespaced lists are returned as is
+	code, b = get(t, s, "dev", "/apis/apps/v1/namespaces/default/deployments")
+	require.Equal(t, 200, code)
+	require.Equal(t, testDeployments("default"), b)
+
+	// lists that are not stored are empty
+	code, b = get(t, s, "dev", "/api/v1/namespaces/default/secrets")
+	require.Equal(t, 200, code)
+	require.Equal(t, `{"kind":"List","apiVersion":"v1","metadata":{},"items":[]}`, string(b))
+
+	// group versions that are not stored have no resources
+	code, b = get(t, s, "dev", "/apis/batch/v1")
+	require.Equal(t, 200, code)
+	require.Equal(t, `{"apiVersion":"v1","groupVersion":"batch/v1","kind":"APIResourceList","resources":[]}`, string(b))
+
+	code, _ = get(t, s, "dev", "/version")
+	require.Equal(t, 404, code)
+	code, b = get(t, s, "prod", "/api/v1/pods")
+	require.Equal(t, 404, code)
+	require.Contains(t, string(b), "context not found in snapshot")
+}
+
+func TestObject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kui-snapshot")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s, err := Open(writeTestSnapshot(t, dir))
+	require.Nil(t, err)
+
+	code, b := get(t, s, "dev", "/api/v1/namespaces/default/pods/web-1")
+	require.Equal(t, 200, code)
+	var obj map[string]interface{}
+	require.Nil(t, json.Unmarshal(b, &obj))
+	require.Equal(t, "Pod", obj["kind"])
+	require.Equal(t, "v1", obj["apiVersion"])
+	require.Equal(t, "web-1", obj["metadata"].(map[string]interface{})["name"])
+
+	code, b = get(t, s, "dev", "/apis/apps/v1/namespaces/kube-system/deployments/kube-system-app")
+	require.Equal(t, 200, code)
+	obj = nil
+	require.Nil(t, json.Unmarshal(b, &obj))
+	require.Equal(t, "Deployment", obj["kind"])
+	require.Equal(t, "apps/v1", obj["apiVersion"])
+
+	// objects are looked up in their own namespace only
+	code, b = get(t, s, "dev", "/api/v1/namespaces/default/pods/dns-1")
+	require.Equal(t, 404, code)
+	require.Contains(t, string(b), `pods \"dns-1\" not found`)
+}
+
+func TestReviews(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kui-snapshot")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s, err := Open(writeTestSnapshot(t, dir))
+	require.Nil(t, err)
+
+	rules := `{"kind": "SelfSubjectRulesReview", "apiVersion": "authorization.k8s.io/v1", "spec": {"namespace": "default"}}`
+	code, b := do(t, s, "dev", http.MethodPost, "/apis/authorization.k8s.io/v1/selfsubjectrulesreviews", rules)
+	require.Equal(t, 201, code)
+	var rr struct {
+		Kind   string `json:"kind"`
+		Status struct {
+			ResourceRules []struct {
+				Verbs     []string `json:"verbs"`
+				APIGroups []string `json:"apiGroups"`
+				Resources []string `json:"resources"`
+			} `json:"resourceRules"`
+			Incomplete bool `json:"incomplete"`
+		} `json:"status"`
+	}
+	require.Nil(t, json.Unmarshal(b, &rr))
+	require.Equal(t, "SelfSubjectRulesReview", rr.Kind)
+	require.Equal(t, 1, len(rr.Status.ResourceRules))
+	require.Equal(t, readOnlyVerbs, rr.Status.ResourceRules[0].Verbs)
+	require.Equal(t, []string{"*"}, rr.Status.ResourceRules[0].Resources)
+	require.False(t, rr.Status.Incomplete)
+
+	for verb, allowed := range map[string]bool{"get": true, "list": true, "watch": true, "delete": false, "create": false} {
+		access := `{"kind": "SelfSubjectAccessReview", "apiVersion": "authorization.k8s.io/v1", "spec": {"resourceAttributes": {"verb": "` + verb + `", "resource": "pods"}}}`
+		code, b := do(t, s, "dev", http.MethodPost, "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews", access)
+		require.Equal(t, 201, code)
+		var ar struct {
+			Status struct {
+				Allowed bool `json:"allowed"`
+			} `json:"status"`
+		}
+		require.Nil(t, json.Unmarshal(b, &ar))
+		require.Equal(t, allowed, ar.Status.Allowed, verb)
+	}
+
+	code, _ = do(t, s, "dev", http.MethodPost, "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews", "not json")
+	require.Equal(t, 400, code)
+}
+
+func TestWritesRejected(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kui-snapshot")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s, err := Open(writeTestSnapshot(t, dir))
+	require.Nil(t, err)
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/api/v1/namespaces/default/pods"},
+		{http.MethodPut, "/api/v1/namespaces/default/pods/web-1"},
+		{http.MethodPatch, "/api/v1/namespaces/default/pods/web-1"},
+		{http.MethodDelete, "/api/v1/namespaces/default/pods/web-1"},
+		{http.MethodPost, "/apis/authorization.k8s.io/v1/subjectaccessreviews"},
+	}
+	for _, test := range tests {
+		code, b := do(t, s, "dev", test.method, test.path, `{}`)
+		require.Equal(t, 405, code, test.method+" "+test.path)
+		require.Contains(t, string(b), "snapshots are read-only")
+	}
+	// the pod is still there
+	code, _ := get(t, s, "dev", "/api/v1/namespaces/default/pods/web-1")
+	require.Equal(t, 200, code)
+}
@@ -0,0 +1,166 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// source provides the files of a snapshot by slash-separated relative name.
+type source interface {
+	names() []string                  // the names of all regular files, sorted
+	read(name string) ([]byte, error) // returns an error satisfying os.IsNotExist for unknown names
+}
+
+// dirSource is a snapshot directory whose files are read on demand.
+type dirSource struct {
+	root  string
+	files map[string]bool
+	list  []string
+}
+
+func newDirSource(root string) (*dirSource, error) {
+	d := &dirSource{root: root, files: map[string]bool{}}
+	err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		d.files[name] = true
+		d.list = append(d.list, name)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "walk %s", root)
+	}
+	sort.Strings(d.list)
+	return d, nil
+}
+
+func (d *dirSource) names() []string {
+	return d.list
+}
+
+// read only reads files found when the directory was walked, such that request
+// paths cannot escape the snapshot.
+func (d *dirSource) read(name string) ([]byte, error) {
+	if !d.files[name] {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.ReadFile(filepath.Join(d.root, filepath.FromSlash(name)))
+}
+
+// memSource is a snapshot held in memory.
+type memSource map[string][]byte
+
+func (m memSource) names() []string {
+	var ret []string
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (m memSource) read(name string) ([]byte, error) {
+	b, ok := m[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return b, nil
+}
+
+// newTarSource reads all regular files of a tarball, optionally gzipped, into memory.
+func newTarSource(file string) (memSource, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, errors.Wrapf(err, "gunzip %s", file)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	m := memSource{}
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %s", file)
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimPrefix(path.Clean("/"+h.Name), "/")
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %s in %s", h.Name, file)
+		}
+		m[name] = b
+	}
+	return m, nil
+}
+
+// subSource is a view of the files of a source below a directory.
+type subSource struct {
+	src    source
+	prefix string // empty or ending with a slash
+}
+
+func (s *subSource) names() []string {
+	var ret []string
+	for _, n := range s.src.names() {
+		if strings.HasPrefix(n, s.prefix) {
+			ret = append(ret, strings.TrimPrefix(n, s.prefix))
+		}
+	}
+	return ret
+}
+
+func (s *subSource) read(name string) ([]byte, error) {
+	return s.src.read(s.prefix + name)
+}
+
+// rootOf returns the directory prefix of the shallowest file with the supplied base
+// name, such that snapshots archived with a top-level directory can be read.
+func rootOf(src source, base string) (string, bool) {
+	var (
+		prefix string
+		found  bool
+	)
+	for _, n := range src.names() {
+		if path.Base(n) != base {
+			continue
+		}
+		p := strings.TrimSuffix(n, base)
+		if !found || strings.Count(p, "/") < strings.Count(prefix, "/") {
+			prefix, found = p, true
+		}
+	}
+	return prefix, found
+}
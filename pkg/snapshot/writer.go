@@ -0,0 +1,156 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// unsafeDirChars are the characters of context names replaced in directory names.
+var unsafeDirChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Writer writes a kui snapshot. The metadata file is written when the writer is closed.
+type Writer struct {
+	meta  Metadata
+	dirs  map[string]bool
+	put   func(name string, b []byte) error
+	close func() error
+}
+
+func newWriter(put func(string, []byte) error, close func() error) *Writer {
+	return &Writer{
+		meta:  Metadata{Version: FormatVersion, Created: time.Now().UTC()},
+		dirs:  map[string]bool{},
+		put:   put,
+		close: close,
+	}
+}
+
+// NewDirWriter returns a writer for a snapshot in the supplied directory, which
+// must not exist or be empty. Files are only readable by the owner.
+func NewDirWriter(dir string) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		return nil, fmt.Errorf("directory %s is not empty", dir)
+	}
+	put := func(name string, b []byte) error {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(file, b, 0600)
+	}
+	return newWriter(put, func() error { return nil }), nil
+}
+
+// NewTarWriter returns a writer for a snapshot tarball, gzipped if requested. The
+// supplied writer is not closed.
+func NewTarWriter(w io.Writer, gzipped bool) *Writer {
+	var gz *gzip.Writer
+	if gzipped {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	sw := newWriter(nil, nil)
+	sw.put = func(name string, b []byte) error {
+		h := &tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    int64(len(b)),
+			ModTime: sw.meta.Created,
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		_, err := tw.Write(b)
+		return err
+	}
+	sw.close = func() error {
+		if err := tw.Close(); err != nil {
+			return err
+		}
+		if gz != nil {
+			return gz.Close()
+		}
+		return nil
+	}
+	return sw
+}
+
+// AddContext adds a context with the supplied default namespace and returns the
+// directory for its API responses.
+func (w *Writer) AddContext(name, namespace string) string {
+	base := strings.Trim(unsafeDirChars.ReplaceAllString(name, "_"), ".")
+	if base == "" {
+		base = "context"
+	}
+	dir := base
+	for i := 2; w.dirs[dir]; i++ {
+		dir = fmt.Sprintf("%s-%d", base, i)
+	}
+	w.dirs[dir] = true
+	w.meta.Contexts = append(w.meta.Contexts, ContextInfo{Name: name, Dir: dir, Namespace: namespace})
+	return dir
+}
+
+// SetRedacted records whether sensitive values were redacted.
+func (w *Writer) SetRedacted(redacted bool) {
+	w.meta.Redacted = redacted
+}
+
+// AddError records an error for an API response that could not be saved.
+func (w *Writer) AddError(msg string) {
+	w.meta.Errors = append(w.meta.Errors, msg)
+}
+
+// Metadata returns the metadata written so far.
+func (w *Writer) Metadata() Metadata {
+	return w.meta
+}
+
+// WriteResponse writes the response for the supplied API path in a context directory.
+func (w *Writer) WriteResponse(dir, apiPath string, b []byte) error {
+	p := path.Clean("/" + apiPath)
+	if p == "/" || !w.dirs[dir] {
+		return fmt.Errorf("invalid response path %s/%s", dir, apiPath)
+	}
+	return w.put(dir+p+".json", b)
+}
+
+// Close writes the metadata and completes the snapshot.
+func (w *Writer) Close() error {
+	b, err := json.MarshalIndent(w.meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := w.put(MetadataFile, b); err != nil {
+		return err
+	}
+	return w.close()
+}
+
+// Name returns a file name for a snapshot of a context, or of a namespace in the
+// context, taken at the supplied time.
+func Name(ctx, namespace string, t time.Time) string {
+	name := strings.Trim(unsafeDirChars.ReplaceAllString(ctx, "_"), ".")
+	if namespace != "" {
+		name += "-" + strings.Trim(unsafeDirChars.ReplaceAllString(namespace, "_"), ".")
+	}
+	return name + "-" + t.Format("20060102-150405")
+}
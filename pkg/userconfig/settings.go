@@ -0,0 +1,110 @@
+package userconfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// settingsFile is the name of the settings file in the configuration directory.
+const settingsFile = "config.yaml"
+
+// Impersonation is the impersonation for all contexts or a single context.
+type Impersonation struct {
+	User   string              `json:"user"`             // user to impersonate
+	UID    string              `json:"uid,omitempty"`    // uid to impersonate
+	Groups []string            `json:"groups,omitempty"` // groups to impersonate
+	Extra  map[string][]string `json:"extra,omitempty"`  // extra values to impersonate
+}
+
+// Settings are the persistent user settings. Flags take precedence over settings
+// for the values that can be set by both.
+type Settings struct {
+	Port                 int                      `json:"port,omitempty"`                 // listen port
+	KubeConfigFiles      []string                 `json:"kubeconfigFiles,omitempty"`      // kubeconfig files, empty uses k8s defaults
+	Impersonation        *Impersonation           `json:"impersonation,omitempty"`        // default impersonation
+	ContextImpersonation map[string]Impersonation `json:"contextImpersonation,omitempty"` // impersonation for specific contexts, empty for none
+	FavoriteContexts     []string                 `json:"favoriteContexts,omitempty"`     // contexts listed first in the UI
+	HiddenKinds          []string                 `json:"hiddenKinds,omitempty"`          // kinds hidden from the navigation
+	ProjectionFiles      []string                 `json:"projectionFiles,omitempty"`      // files with declarative projections
+	UI                   map[string]interface{}   `json:"ui,omitempty"`                   // preferences that are only used by the UI
+}
+
+// Validate returns an error if the settings are invalid.
+func (s *Settings) Validate() error {
+	if s.Port < 0 || s.Port > 65535 {
+		return fmt.Errorf("invalid port %d", s.Port)
+	}
+	if s.Impersonation != nil && s.Impersonation.User == "" {
+		return fmt.Errorf("impersonation requires a user")
+	}
+	for ctx, imp := range s.ContextImpersonation {
+		// an empty entry turns off the default impersonation for the context
+		if imp.User == "" && (imp.UID != "" || len(imp.Groups) > 0 || len(imp.Extra) > 0) {
+			return fmt.Errorf("impersonation for context %s requires a user", ctx)
+		}
+	}
+	return nil
+}
+
+// SettingsPath returns the path of the settings file.
+func SettingsPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, settingsFile), nil
+}
+
+// LoadSettings loads the settings from the supplied file. Empty settings are
+// returned if the file does not exist.
+func LoadSettings(file string) (*Settings, error) {
+	var s Settings
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &s, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, &s); err != nil {
+		return nil, errors.Wrapf(err, "parse %s", file)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "validate %s", file)
+	}
+	return &s, nil
+}
+
+// SaveSettings validates the settings and writes them to the supplied file. The
+// file is replaced atomically and is only readable by the owner.
+func SaveSettings(file string, s *Settings) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	b, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".config-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,64 @@
+// Package userconfig locates the per-user configuration directory for kui.
+package userconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// appName is the name of the kui directory under the user config directory.
+const appName = "kui"
+
+// baseDir returns the platform-specific user configuration directory.
+func baseDir() (string, error) {
+	switch runtime.GOOS {
+	case "windows":
+		if dir := os.Getenv("AppData"); dir != "" {
+			return dir, nil
+		}
+		return "", errors.New("%AppData% is not defined")
+	case "darwin":
+		if home := os.Getenv("HOME"); home != "" {
+			return filepath.Join(home, "Library", "Application Support"), nil
+		}
+		return "", errors.New("$HOME is not defined")
+	default:
+		if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+			return dir, nil
+		}
+		if home := os.Getenv("HOME"); home != "" {
+			return filepath.Join(home, ".config"), nil
+		}
+		return "", errors.New("neither $XDG_CONFIG_HOME nor $HOME is defined")
+	}
+}
+
+// Dir returns the kui configuration directory, creating it with owner-only
+// permissions if it does not exist.
+func Dir() (string, error) {
+	base, err := baseDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(base, appName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// RuntimeDir returns the directory for runtime files such as sockets, creating it
+// with owner-only permissions if it does not exist. It is under $XDG_RUNTIME_DIR
+// when set and the configuration directory otherwise.
+func RuntimeDir() (string, error) {
+	if base := os.Getenv("XDG_RUNTIME_DIR"); base != "" {
+		dir := filepath.Join(base, appName)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", err
+		}
+		return dir, nil
+	}
+	return Dir()
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/getlantern/systray"
+	"github.com/gotwarlost/kui/pkg/server"
+)
+
+// trayRefreshInterval is how often the context menu is rebuilt from the kubeconfig.
+const trayRefreshInterval = 10 * time.Second
+
+// contextPath returns the UI path for a context and optional namespace.
+func contextPath(ctx, ns string) string {
+	p := "/ui/" + url.PathEscape(ctx)
+	if ns != "" {
+		p += "/ns," + url.PathEscape(ns)
+	}
+	return p
+}
+
+// trayItem is a menu item that can be reassigned to a different UI path when the
+// menu is refreshed. Menu items cannot be removed, so unused items are hidden.
+type trayItem struct {
+	item *systray.MenuItem
+	l    sync.Mutex
+	path string
+}
+
+// newTrayItem wraps the supplied menu item and opens a browser on its current path
+// when it is clicked.
+func newTrayItem(item *systray.MenuItem) *trayItem {
+	ti := &trayItem{item: item}
+	go func() {
+		for range item.ClickedCh {
+			ti.l.Lock()
+			p := ti.path
+			ti.l.Unlock()
+			openBrowserAt(p)
+		}
+	}()
+	return ti
+}
+
+// set updates the title and path of the item and shows it.
+func (ti *trayItem) set(title, path string) {
+	ti.l.Lock()
+	ti.path = path
+	ti.l.Unlock()
+	ti.item.SetTitle(title)
+	ti.item.Show()
+}
+
+// hide hides the item.
+func (ti *trayItem) hide() {
+	ti.item.Hide()
+}
+
+// contextItem is the submenu for a single context with entries for the default
+// namespace and recently used namespaces.
+type contextItem struct {
+	item       *systray.MenuItem
+	open       *trayItem
+	namespaces []*trayItem
+}
+
+// contextMenu maintains the submenu of contexts.
+type contextMenu struct {
+	h        server.APIHandler
+	parent   *systray.MenuItem
+	items    []*contextItem
+	contexts []string
+	recent   map[string][]string
+}
+
+// newContextMenu adds the context submenu to the tray.
+func newContextMenu(h server.APIHandler) *contextMenu {
+	return &contextMenu{
+		h:      h,
+		parent: systray.AddMenuItem("Open context", "opens a browser on a specific context"),
+	}
+}
+
+// contextItemAt returns the context item at the supplied index, adding items as needed.
+func (m *contextMenu) contextItemAt(i int) *contextItem {
+	for len(m.items) <= i {
+		item := m.parent.AddSubMenuItem("", "")
+		ci := &contextItem{
+			item: item,
+			open: newTrayItem(item.AddSubMenuItem("Default namespace", "opens the default namespace of the context")),
+		}
+		m.items = append(m.items, ci)
+	}
+	return m.items[i]
+}
+
+// refresh rebuilds the menu if the contexts or recent namespaces have changed.
+func (m *contextMenu) refresh() {
+	contexts, err := m.h.ContextNames()
+	if err != nil {
+		log.Println("tray: unable to load contexts,", err)
+		return
+	}
+	contexts = append([]string(nil), contexts...)
+	sort.Strings(contexts)
+	recent := map[string][]string{}
+	for _, ctx := range contexts {
+		recent[ctx] = m.h.RecentNamespaces(ctx)
+	}
+	if reflect.DeepEqual(contexts, m.contexts) && reflect.DeepEqual(recent, m.recent) {
+		return
+	}
+	m.contexts, m.recent = contexts, recent
+
+	for i, ctx := range contexts {
+		ci := m.contextItemAt(i)
+		ci.item.SetTitle(ctx)
+		ci.item.Show()
+		ci.open.set("Default namespace", contextPath(ctx, ""))
+		for j, ns := range recent[ctx] {
+			if j == len(ci.namespaces) {
+				ci.namespaces = append(ci.namespaces, newTrayItem(ci.item.AddSubMenuItem("", "")))
+			}
+			ci.namespaces[j].set(fmt.Sprintf("Namespace %s", ns), contextPath(ctx, ns))
+		}
+		for _, ti := range ci.namespaces[len(recent[ctx]):] {
+			ti.hide()
+		}
+	}
+	for _, ci := range m.items[len(contexts):] {
+		ci.item.Hide()
+	}
+	if len(contexts) == 0 {
+		m.parent.Disable()
+	} else {
+		m.parent.Enable()
+	}
+}
+
+// watch refreshes the menu periodically such that it tracks kubeconfig changes and
+// recently used namespaces.
+func (m *contextMenu) watch() {
+	m.refresh()
+	for range time.Tick(trayRefreshInterval) {
+		m.refresh()
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// version returns the program version, which is Version when set at link time
+// and the module version from the build info otherwise.
+func version() string {
+	if Version != "" {
+		return Version
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		return bi.Main.Version
+	}
+	return "dev"
+}
+
+// revision returns the abbreviated VCS revision from the build info, if available.
+func revision() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	var rev, modified string
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			rev = s.Value
+		case "vcs.modified":
+			if s.Value == "true" {
+				modified = "-dirty"
+			}
+		}
+	}
+	if len(rev) > 12 {
+		rev = rev[:12]
+	}
+	if rev == "" {
+		return ""
+	}
+	return rev + modified
+}
+
+// versionString returns the full version information printed by the version command.
+func versionString() string {
+	s := "kui version " + version()
+	if rev := revision(); rev != "" {
+		s += ", revision " + rev
+	}
+	return fmt.Sprintf("%s, %s %s/%s", s, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// userAgent returns the user agent for requests to the Kubernetes API, with the
+// revision added to the version as build metadata, for example
+// kui/v1.2.0+0123456789ab (linux/amd64).
+func userAgent() string {
+	v := version()
+	if rev := revision(); rev != "" {
+		sep := "+"
+		if strings.Contains(v, "+") {
+			sep = "."
+		}
+		v += sep + rev
+	}
+	return fmt.Sprintf("kui/%s (%s/%s)", v, runtime.GOOS, runtime.GOARCH)
+}